@@ -0,0 +1,122 @@
+package bosh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A Director is a BOSH director, as known to the BOSH CLI (by alias,
+// URL or IP, per `bosh -e`).  All interaction goes through the CLI, so
+// that operators' ~/.bosh/config (and $BOSH_* variables) are honored.
+type Director struct {
+	Environment string
+	Interactive bool
+}
+
+type DeployOptions struct {
+	DryRun    bool
+	Recreate  bool
+	Fix       bool
+	SkipDrain bool
+}
+
+func (d Director) command(deployment string, args ...string) *exec.Cmd {
+	pre := []string{}
+	if !d.Interactive {
+		pre = append(pre, "-n")
+	}
+	if d.Environment != "" {
+		pre = append(pre, "-e", d.Environment)
+	}
+	if deployment != "" {
+		pre = append(pre, "-d", deployment)
+	}
+
+	cmd := exec.Command("bosh", append(pre, args...)...)
+	cmd.Env = os.Environ()
+	return cmd
+}
+
+// run a non-interactive bosh command, returning its standard output
+func (d Director) output(deployment string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	d.Interactive = false
+	cmd := d.command(deployment, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("`bosh %s` failed: %s", strings.Join(args, " "), msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Deploy a manifest (from a file on disk), with the BOSH CLI talking
+// directly to the operator via our standard input / output / error.
+func (d Director) Deploy(deployment, manifest string, opts DeployOptions) error {
+	args := []string{"deploy", manifest}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if opts.Recreate {
+		args = append(args, "--recreate")
+	}
+	if opts.Fix {
+		args = append(args, "--fix")
+	}
+	if opts.SkipDrain {
+		args = append(args, "--skip-drain")
+	}
+
+	cmd := d.command(deployment, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("`bosh deploy` failed: %s", err)
+	}
+	return nil
+}
+
+// Upload a (named) runtime-config, from a file on disk.
+func (d Director) UpdateRuntimeConfig(name, file string) error {
+	cmd := d.command("", "update-runtime-config", "--name", name, file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("`bosh update-runtime-config` failed: %s", err)
+	}
+	return nil
+}
+
+// Run an errand, showing its output as it goes.
+func (d Director) RunErrand(deployment, errand string) error {
+	cmd := d.command(deployment, "run-errand", errand)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("`bosh run-errand %s` failed: %s", errand, err)
+	}
+	return nil
+}
+
+// The manifest that is currently deployed.
+func (d Director) Manifest(deployment string) ([]byte, error) {
+	return d.output(deployment, "manifest")
+}
+
+// The director's current cloud-config.
+func (d Director) CloudConfig() ([]byte, error) {
+	return d.output("", "cloud-config")
+}
@@ -0,0 +1,217 @@
+package bosh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type named struct {
+	Name string `yaml:"name"`
+}
+
+type subnet struct {
+	AZ     string   `yaml:"az"`
+	AZs    []string `yaml:"azs"`
+	Static []string `yaml:"static"`
+}
+
+type network struct {
+	Name    string   `yaml:"name"`
+	Subnets []subnet `yaml:"subnets"`
+}
+
+type cloudConfig struct {
+	AZs          []named   `yaml:"azs"`
+	Networks     []network `yaml:"networks"`
+	VMTypes      []named   `yaml:"vm_types"`
+	DiskTypes    []named   `yaml:"disk_types"`
+	VMExtensions []named   `yaml:"vm_extensions"`
+}
+
+type instanceGroup struct {
+	Name         string   `yaml:"name"`
+	AZs          []string `yaml:"azs"`
+	Networks     []named  `yaml:"networks"`
+	VMType       string   `yaml:"vm_type"`
+	DiskType     string   `yaml:"persistent_disk_type"`
+	VMExtensions []string `yaml:"vm_extensions"`
+}
+
+type deployment struct {
+	InstanceGroups []instanceGroup `yaml:"instance_groups"`
+	Jobs           []instanceGroup `yaml:"jobs"` // pre-v2 manifests
+}
+
+// A CloudConfigError lists everything a manifest refers to that is not
+// defined in the cloud-config, i.e. "vm_type 'large' (used by consul)".
+type CloudConfigError struct {
+	Missing []string
+}
+
+func (e CloudConfigError) Error() string {
+	return "the following are not defined in the cloud-config:\n  - " + strings.Join(e.Missing, "\n  - ")
+}
+
+// Check that every AZ, network, VM type, disk type and VM extension that
+// a manifest refers to is defined in the cloud-config.
+func CheckCloudConfig(manifest, cloud []byte) error {
+	var cc cloudConfig
+	if err := yaml.Unmarshal(cloud, &cc); err != nil {
+		return fmt.Errorf("unable to parse cloud-config: %s", err)
+	}
+	var m deployment
+	if err := yaml.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("unable to parse manifest: %s", err)
+	}
+
+	defined := func(l []named) map[string]bool {
+		h := make(map[string]bool)
+		for _, x := range l {
+			h[x.Name] = true
+		}
+		return h
+	}
+	networks := make(map[string]bool)
+	for _, n := range cc.Networks {
+		networks[n.Name] = true
+	}
+	kinds := []struct {
+		kind    string
+		defined map[string]bool
+	}{
+		{"az", defined(cc.AZs)},
+		{"network", networks},
+		{"vm_type", defined(cc.VMTypes)},
+		{"disk_type", defined(cc.DiskTypes)},
+		{"vm_extension", defined(cc.VMExtensions)},
+	}
+
+	// kind -> name -> instance groups using it
+	used := make(map[string]map[string][]string)
+	use := func(kind, name, by string) {
+		if name == "" {
+			return
+		}
+		if used[kind] == nil {
+			used[kind] = make(map[string][]string)
+		}
+		used[kind][name] = append(used[kind][name], by)
+	}
+	for _, ig := range append(m.InstanceGroups, m.Jobs...) {
+		for _, az := range ig.AZs {
+			use("az", az, ig.Name)
+		}
+		for _, n := range ig.Networks {
+			use("network", n.Name, ig.Name)
+		}
+		use("vm_type", ig.VMType, ig.Name)
+		use("disk_type", ig.DiskType, ig.Name)
+		for _, ext := range ig.VMExtensions {
+			use("vm_extension", ext, ig.Name)
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, k := range kinds {
+		names := make([]string, 0)
+		for name := range used[k.kind] {
+			if !k.defined[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			missing = append(missing, fmt.Sprintf("%s '%s' (used by %s)", k.kind, name,
+				strings.Join(used[k.kind][name], ", ")))
+		}
+	}
+
+	if len(missing) > 0 {
+		return CloudConfigError{Missing: missing}
+	}
+	return nil
+}
+
+// All of the static IPs of a network, in order, from those subnets that
+// are in any of the given AZs (or from all subnets, if azs is empty).
+// Static ranges can be single IPs, or ranges like "10.0.0.10 - 10.0.0.20".
+func StaticIPs(cloud []byte, network string, azs []string) ([]string, error) {
+	var cc cloudConfig
+	if err := yaml.Unmarshal(cloud, &cc); err != nil {
+		return nil, fmt.Errorf("unable to parse cloud-config: %s", err)
+	}
+
+	want := make(map[string]bool)
+	for _, az := range azs {
+		want[az] = true
+	}
+
+	for _, n := range cc.Networks {
+		if n.Name != network {
+			continue
+		}
+
+		ips := make([]string, 0)
+		for _, sub := range n.Subnets {
+			if len(want) > 0 {
+				ok := want[sub.AZ]
+				for _, az := range sub.AZs {
+					ok = ok || want[az]
+				}
+				if !ok {
+					continue
+				}
+			}
+			for _, r := range sub.Static {
+				l, err := expand(r)
+				if err != nil {
+					return nil, fmt.Errorf("network '%s': %s", network, err)
+				}
+				ips = append(ips, l...)
+			}
+		}
+		return ips, nil
+	}
+	return nil, fmt.Errorf("network '%s' is not defined in the cloud-config", network)
+}
+
+func ipv4(s string) (uint32, error) {
+	ip := net.ParseIP(strings.TrimSpace(s)).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("'%s' is not a valid IPv4 address", strings.TrimSpace(s))
+	}
+	return binary.BigEndian.Uint32(ip), nil
+}
+
+func expand(r string) ([]string, error) {
+	ends := strings.SplitN(r, "-", 2)
+	first, err := ipv4(ends[0])
+	if err != nil {
+		return nil, err
+	}
+	last := first
+	if len(ends) == 2 {
+		if last, err = ipv4(ends[1]); err != nil {
+			return nil, err
+		}
+		if last < first {
+			return nil, fmt.Errorf("static range '%s' is backwards", r)
+		}
+	}
+
+	l := make([]string, 0, last-first+1)
+	for n := first; ; n++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, n)
+		l = append(l, ip.String())
+		if n == last {
+			break
+		}
+	}
+	return l, nil
+}
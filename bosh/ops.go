@@ -0,0 +1,305 @@
+package bosh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// An Op is a single BOSH ops-file operation, i.e.
+//
+//   - type:  replace
+//     path:  /instance_groups/name=consul/jobs/name=consul/properties/domain?
+//     value: example.com
+//
+// Paths are made up of map keys, list indices, `-` (after the last list
+// element), and `key=value` selectors that find the one list element with
+// a matching key.  Any token can be marked optional with a trailing `?`,
+// which makes it, and everything after it, optional; missing map keys
+// and list elements are created by replace operations, and ignored by
+// remove operations.
+type Op struct {
+	Type  string      `yaml:"type"`
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+}
+
+type token struct {
+	key      string
+	index    int
+	append   bool
+	match    string // key, for key=value selectors
+	optional bool
+}
+
+func (t token) String() string {
+	switch {
+	case t.append:
+		return "-"
+	case t.match != "":
+		return t.match + "=" + t.key
+	case t.index >= 0:
+		return strconv.Itoa(t.index)
+	}
+	return t.key
+}
+
+func unescape(s string) string {
+	return strings.Replace(strings.Replace(s, "~1", "/", -1), "~0", "~", -1)
+}
+
+func parsePath(path string) ([]token, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path '%s' must start with a '/'", path)
+	}
+
+	l := make([]token, 0)
+	optional := false
+	for _, s := range strings.Split(path[1:], "/") {
+		if strings.HasSuffix(s, "?") {
+			s = strings.TrimSuffix(s, "?")
+			optional = true
+		}
+		t := token{index: -1, optional: optional}
+
+		if s == "" {
+			return nil, fmt.Errorf("path '%s' has an empty component", path)
+		} else if s == "-" {
+			t.append = true
+		} else if i, err := strconv.Atoi(s); err == nil {
+			if i < 0 {
+				return nil, fmt.Errorf("path '%s' has a negative list index", path)
+			}
+			t.index = i
+		} else if kv := strings.SplitN(s, "=", 2); len(kv) == 2 {
+			t.match, t.key = unescape(kv[0]), unescape(kv[1])
+		} else {
+			t.key = unescape(s)
+		}
+		l = append(l, t)
+	}
+	return l, nil
+}
+
+func find(l []interface{}, t token) (int, error) {
+	found := -1
+	for i, v := range l {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if x, ok := m[t.match]; ok && fmt.Sprintf("%v", x) == t.key {
+			if found >= 0 {
+				return -1, fmt.Errorf("found more than one list element where %s", t)
+			}
+			found = i
+		}
+	}
+	return found, nil
+}
+
+func replace(node interface{}, path []token, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	t, rest := path[0], path[1:]
+
+	if t.key != "" && t.match == "" {
+		if node == nil && t.optional {
+			node = make(map[interface{}]interface{})
+		}
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a map at '%s'", t)
+		}
+		v, found := m[t.key]
+		if !found && !t.optional {
+			return nil, fmt.Errorf("no such key '%s'", t)
+		}
+		v, err := replace(v, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		m[t.key] = v
+		return m, nil
+	}
+
+	if node == nil && t.optional {
+		node = make([]interface{}, 0)
+	}
+	l, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list at '%s'", t)
+	}
+
+	switch {
+	case t.append:
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("'-' must be the last part of the path")
+		}
+		return append(l, value), nil
+
+	case t.match != "":
+		i, err := find(l, t)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			if !t.optional {
+				return nil, fmt.Errorf("found no list element where %s", t)
+			}
+			if len(rest) == 0 {
+				return append(l, value), nil
+			}
+			l = append(l, map[interface{}]interface{}{t.match: t.key})
+			i = len(l) - 1
+		}
+		v, err := replace(l[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		l[i] = v
+		return l, nil
+	}
+
+	if t.index >= len(l) {
+		return nil, fmt.Errorf("list index %d is out of range (list has %d elements)", t.index, len(l))
+	}
+	v, err := replace(l[t.index], rest, value)
+	if err != nil {
+		return nil, err
+	}
+	l[t.index] = v
+	return l, nil
+}
+
+func remove(node interface{}, path []token) (interface{}, error) {
+	t, rest := path[0], path[1:]
+
+	if t.key != "" && t.match == "" {
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			if node == nil && t.optional {
+				return node, nil
+			}
+			return nil, fmt.Errorf("expected a map at '%s'", t)
+		}
+		v, found := m[t.key]
+		if !found {
+			if t.optional {
+				return m, nil
+			}
+			return nil, fmt.Errorf("no such key '%s'", t)
+		}
+		if len(rest) == 0 {
+			delete(m, t.key)
+			return m, nil
+		}
+		v, err := remove(v, rest)
+		if err != nil {
+			return nil, err
+		}
+		m[t.key] = v
+		return m, nil
+	}
+
+	l, ok := node.([]interface{})
+	if !ok {
+		if node == nil && t.optional {
+			return node, nil
+		}
+		return nil, fmt.Errorf("expected a list at '%s'", t)
+	}
+
+	i := t.index
+	switch {
+	case t.append:
+		return nil, fmt.Errorf("cannot remove '-' (the end of a list)")
+
+	case t.match != "":
+		var err error
+		if i, err = find(l, t); err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			if t.optional {
+				return l, nil
+			}
+			return nil, fmt.Errorf("found no list element where %s", t)
+		}
+
+	case i >= len(l):
+		return nil, fmt.Errorf("list index %d is out of range (list has %d elements)", i, len(l))
+	}
+
+	if len(rest) == 0 {
+		return append(l[:i], l[i+1:]...), nil
+	}
+	v, err := remove(l[i], rest)
+	if err != nil {
+		return nil, err
+	}
+	l[i] = v
+	return l, nil
+}
+
+// Apply a single operation to a (parsed) YAML document.
+func (op Op) Apply(doc interface{}) (interface{}, error) {
+	if op.Path == "/" {
+		if op.Type == "replace" {
+			return op.Value, nil
+		}
+		return nil, fmt.Errorf("cannot %s the entire document", op.Type)
+	}
+	path, err := parsePath(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Type {
+	case "replace":
+		return replace(doc, path, op.Value)
+	case "remove":
+		return remove(doc, path)
+	}
+	return nil, fmt.Errorf("unrecognized operation type '%s' (must be one of replace, remove)", op.Type)
+}
+
+func ReadOpsFile(file string) ([]Op, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ops []Op
+	if err := yaml.Unmarshal(b, &ops); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return ops, nil
+}
+
+// Apply ops-files, in order, to a manifest.
+func ApplyOpsFiles(manifest []byte, files []string) ([]byte, error) {
+	if len(files) == 0 {
+		return manifest, nil
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(manifest, &doc); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		ops, err := ReadOpsFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for i, op := range ops {
+			if doc, err = op.Apply(doc); err != nil {
+				return nil, fmt.Errorf("%s, operation #%d (%s %s): %s", file, i+1, op.Type, op.Path, err)
+			}
+		}
+	}
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,350 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	gopath "path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+
+	// what spruce puts in place of credentials, under REDACT=yes
+	Redacted = "REDACTED"
+)
+
+// A Change is a single difference between two YAML documents, at a
+// spruce-style path (i.e. `jobs.consul.properties.domain`), where
+// elements of lists of named maps are addressed by their name, and
+// elements of any other list by their index.
+type Change struct {
+	Path string
+	Kind string
+	Old  interface{}
+	New  interface{}
+}
+
+// Parse a YAML document, for comparison.
+func Parse(b []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Compare two (parsed) YAML documents, returning all of the changes it
+// would take to get from a to b, in a stable order.
+func Compare(a, b interface{}) []Change {
+	return compare("", a, b)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func compare(path string, a, b interface{}) []Change {
+	if ma, ok := a.(map[interface{}]interface{}); ok {
+		if mb, ok := b.(map[interface{}]interface{}); ok {
+			return compareMaps(path, ma, mb)
+		}
+	}
+	if la, ok := a.([]interface{}); ok {
+		if lb, ok := b.([]interface{}); ok {
+			return compareLists(path, la, lb)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []Change{{Path: path, Kind: Changed, Old: a, New: b}}
+}
+
+func keys(m map[interface{}]interface{}) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, fmt.Sprintf("%v", k))
+	}
+	sort.Strings(l)
+	return l
+}
+
+func get(m map[interface{}]interface{}, key string) (interface{}, bool) {
+	for k, v := range m {
+		if fmt.Sprintf("%v", k) == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func compareMaps(path string, a, b map[interface{}]interface{}) []Change {
+	changes := make([]Change, 0)
+
+	seen := make(map[string]bool)
+	for _, k := range keys(a) {
+		seen[k] = true
+		va, _ := get(a, k)
+		if vb, ok := get(b, k); ok {
+			changes = append(changes, compare(join(path, k), va, vb)...)
+		} else {
+			changes = append(changes, Change{Path: join(path, k), Kind: Removed, Old: va})
+		}
+	}
+	for _, k := range keys(b) {
+		if !seen[k] {
+			vb, _ := get(b, k)
+			changes = append(changes, Change{Path: join(path, k), Kind: Added, New: vb})
+		}
+	}
+	return changes
+}
+
+// the names of all elements of a list, if they are all maps with
+// (distinct) names, so that they can be matched up by name
+func names(l []interface{}) ([]string, bool) {
+	seen := make(map[string]bool)
+	names := make([]string, len(l))
+	for i, v := range l {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"]
+		if !ok || seen[fmt.Sprintf("%v", name)] {
+			return nil, false
+		}
+		names[i] = fmt.Sprintf("%v", name)
+		seen[names[i]] = true
+	}
+	return names, true
+}
+
+func scalars(l []interface{}) bool {
+	for _, v := range l {
+		switch v.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func compareLists(path string, a, b []interface{}) []Change {
+	// lists of scalars (static IPs, AZs, etc.) only make sense as a whole
+	if scalars(a) && scalars(b) {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []Change{{Path: path, Kind: Changed, Old: a, New: b}}
+	}
+
+	changes := make([]Change, 0)
+	na, oka := names(a)
+	nb, okb := names(b)
+	if oka && okb {
+		idx := make(map[string]int)
+		for i, name := range nb {
+			idx[name] = i
+		}
+		seen := make(map[string]bool)
+		for i, name := range na {
+			seen[name] = true
+			if j, ok := idx[name]; ok {
+				changes = append(changes, compare(join(path, name), a[i], b[j])...)
+			} else {
+				changes = append(changes, Change{Path: join(path, name), Kind: Removed, Old: a[i]})
+			}
+		}
+		for j, name := range nb {
+			if !seen[name] {
+				changes = append(changes, Change{Path: join(path, name), Kind: Added, New: b[j]})
+			}
+		}
+		return changes
+	}
+
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := join(path, strconv.Itoa(i))
+		switch {
+		case i >= len(b):
+			changes = append(changes, Change{Path: p, Kind: Removed, Old: a[i]})
+		case i >= len(a):
+			changes = append(changes, Change{Path: p, Kind: Added, New: b[i]})
+		default:
+			changes = append(changes, compare(p, a[i], b[i])...)
+		}
+	}
+	return changes
+}
+
+// Get the value at a spruce-style path.
+func Get(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+	v := doc
+	for _, k := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[interface{}]interface{}:
+			var ok bool
+			if v, ok = get(x, k); !ok {
+				return nil, false
+			}
+
+		case []interface{}:
+			found := false
+			if l, ok := names(x); ok {
+				for i, name := range l {
+					if name == k {
+						v, found = x[i], true
+						break
+					}
+				}
+			}
+			if !found {
+				i, err := strconv.Atoi(k)
+				if err != nil || i < 0 || i >= len(x) {
+					return nil, false
+				}
+				v = x[i]
+			}
+
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Walk a document, calling fn with the path to, and value of, every
+// node in it (maps and lists included), parents before children.
+func Walk(doc interface{}, fn func(path string, v interface{})) {
+	var walk func(string, interface{})
+	walk = func(path string, x interface{}) {
+		fn(path, x)
+		switch x := x.(type) {
+		case map[interface{}]interface{}:
+			for _, k := range keys(x) {
+				sub, _ := get(x, k)
+				walk(join(path, k), sub)
+			}
+
+		case []interface{}:
+			l, named := names(x)
+			for i, sub := range x {
+				if named {
+					walk(join(path, l[i]), sub)
+				} else {
+					walk(join(path, strconv.Itoa(i)), sub)
+				}
+			}
+		}
+	}
+	walk("", doc)
+}
+
+// Find the paths to all scalar values in a document that are equal to v.
+func Find(doc interface{}, v interface{}) []string {
+	paths := make([]string, 0)
+	Walk(doc, func(path string, x interface{}) {
+		switch x.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return
+		}
+		if reflect.DeepEqual(x, v) {
+			paths = append(paths, path)
+		}
+	})
+	return paths
+}
+
+// Match a path against a pattern, component by component, where each
+// component of the pattern can contain shell-style wildcards.
+func Match(path, pattern string) bool {
+	return len(strings.Split(path, ".")) == len(strings.Split(pattern, ".")) && under(path, pattern)
+}
+
+// Ignore all changes at, or underneath, any of the given paths.  Paths
+// can contain shell-style wildcards in any of their components, so that
+// `jobs.*.properties.domain` ignores domain changes in every job.
+func Ignore(changes []Change, patterns []string) []Change {
+	l := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		skip := false
+		for _, p := range patterns {
+			if under(c.Path, p) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+func under(path, pattern string) bool {
+	have := strings.Split(path, ".")
+	want := strings.Split(pattern, ".")
+	if len(want) > len(have) {
+		return false
+	}
+	for i := range want {
+		if ok, err := gopath.Match(want[i], have[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func lines(v interface{}) []string {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return []string{fmt.Sprintf("%v", v)}
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// Print changes in a (colorized, where possible) unified-diff-like
+// format; each changed path, followed by the old and new values.
+func Print(out io.Writer, changes []Change) {
+	for i, c := range changes {
+		if i > 0 {
+			ansi.Fprintf(out, "\n")
+		}
+		ansi.Fprintf(out, "@C{%s}", c.Path)
+		switch c.Kind {
+		case Added:
+			ansi.Fprintf(out, " @G{(added)}\n")
+		case Removed:
+			ansi.Fprintf(out, " @R{(removed)}\n")
+		default:
+			ansi.Fprintf(out, "\n")
+		}
+
+		if c.Kind != Added {
+			for _, l := range lines(c.Old) {
+				ansi.Fprintf(out, "  @R{- %s}\n", l)
+			}
+		}
+		if c.Kind != Removed {
+			for _, l := range lines(c.New) {
+				ansi.Fprintf(out, "  @G{+ %s}\n", l)
+			}
+		}
+	}
+}
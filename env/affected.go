@@ -0,0 +1,162 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/report"
+)
+
+// How an environment is affected by a change.
+const (
+	Directly   = "directly"   // what it deploys has changed
+	Pipeline   = "pipeline"   // its stage of the pipeline has changed, or been triggered
+	Downstream = "downstream" // something upstream of it in the pipeline is affected
+)
+
+var DefaultAffectedColumns = []string{"env", "how", "because"}
+
+// An Impact is an environment affected by a change, and why; Because
+// lists the changed files (or, for Downstream, upstream environments).
+type Impact struct {
+	Env     string
+	How     string
+	Because []string
+}
+
+func AffectedColumns() []report.Column {
+	return []report.Column{
+		{Key: "env", Header: "Environment"},
+		{Key: "how", Header: "How"},
+		{Key: "because", Header: "Because Of", Display: func(v interface{}) string {
+			return strings.Join(v.([]string), ", ")
+		}},
+	}
+}
+
+// Build a report on the given impacts.
+func AffectedReport(l []Impact, columns []string) (report.Report, error) {
+	cols, err := report.Select(AffectedColumns(), columns)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	r := report.Report{Columns: cols}
+	for _, i := range l {
+		r.Rows = append(r.Rows, report.Row{Values: map[string]interface{}{
+			"env":     i.Env,
+			"how":     i.How,
+			"because": i.Because,
+		}})
+	}
+	return r, nil
+}
+
+// The files (relative to root) changed in the deployments repo at root,
+// over a revision range, as `git diff` understands them (i.e. `HEAD~3`
+// or `origin/master..HEAD`).  Without one, it's the changes that haven't
+// been committed yet, including new files.
+func Changed(root, revs string) ([]string, error) {
+	git := func(args ...string) ([]string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("git", append([]string{"-C", root}, args...)...)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return nil, fmt.Errorf("`git %s` failed: %s", args[0], msg)
+		}
+		// NUL-terminated (-z), since paths can have spaces (or worse) in them
+		l := strings.Split(string(b), "\x00")
+		return l[:len(l)-1], nil
+	}
+
+	if revs != "" {
+		return git("diff", "--name-only", "-z", "--relative", revs)
+	}
+	l, err := git("diff", "--name-only", "-z", "--relative", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return append(l, untracked...), nil
+}
+
+// The changed files (if any) that make up part of this environment:
+// files in its hierarchy (which may have been deleted), and its kit,
+// either under dev/ or as a compiled tarball.
+func (e Env) changed(files []string) ([]string, error) {
+	name, _, err := e.Param("kit")
+	if err != nil {
+		return nil, err
+	}
+	version, _, err := e.Param("version")
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]string, 0)
+	for _, file := range files {
+		switch {
+		case filepath.Dir(file) == "." && strings.HasSuffix(file, ".yml"):
+			prefix := strings.TrimSuffix(file, ".yml")
+			if e.Name == prefix || strings.HasPrefix(e.Name, prefix+"-") {
+				l = append(l, file)
+			}
+
+		case strings.HasPrefix(file, kit.DevDirectory+"/"):
+			if name == nil || name == "dev" {
+				l = append(l, file)
+			}
+
+		case filepath.Dir(file) == filepath.Join(".genesis", "kits") && strings.HasSuffix(file, ".tar.gz"):
+			// versions can have dashes in them too (i.e. 6.3.0-rc.1)
+			base := strings.TrimSuffix(filepath.Base(file), ".tar.gz")
+			if name == nil || !strings.HasPrefix(base, fmt.Sprintf("%v-", name)) {
+				continue
+			}
+			v := strings.TrimPrefix(base, fmt.Sprintf("%v-", name))
+			if version == nil {
+				// any version, but not other kits named like it (i.e. shield-agent)
+				if v == "" || v[0] < '0' || v[0] > '9' {
+					continue
+				}
+			} else if v != fmt.Sprintf("%v", version) {
+				continue
+			}
+			l = append(l, file)
+		}
+	}
+	return l, nil
+}
+
+// The environments (in the deployments repo at root) that changes to the
+// given files affect directly, in order.
+func Affected(root string, files []string) ([]Impact, error) {
+	envs, err := All(root)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]Impact, 0)
+	for _, e := range envs {
+		because, err := e.changed(files)
+		if err != nil {
+			return nil, err
+		}
+		if len(because) > 0 {
+			l = append(l, Impact{Env: e.Name, How: Directly, Because: because})
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,47 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const CachedDirectory = ".genesis/cached"
+
+// where files about this environment (deployment timestamps, propagated
+// YAML files, etc.) are kept, i.e. .genesis/cached/us-west-1-prod
+func (e Env) CachedDir() string {
+	return filepath.Join(e.Root, CachedDirectory, e.Name)
+}
+
+// When this environment was last (successfully) deployed, according to
+// its deployment ledger, or .genesis/cached/ENV/last for environments
+// deployed before there was a ledger.
+func (e Env) LastDeployed() (time.Time, bool, error) {
+	l, err := e.History()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for i := len(l) - 1; i >= 0; i-- {
+		if l[i].Outcome == Succeeded {
+			return l[i].Time, true, nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(e.CachedDir(), "last"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(ts, 0), true, nil
+}
@@ -0,0 +1,65 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jhunt/genesis/bosh"
+)
+
+const CachedCloudConfigFile = "cloud.yml"
+
+func (e Env) CachedCloudConfig() string {
+	return filepath.Join(e.CachedDir(), CachedCloudConfigFile)
+}
+
+// Fetch the cloud-config from the environment's BOSH director, and keep
+// a copy of it in .genesis/cached/ENV/cloud.yml; returns the path to it.
+func (e Env) FetchCloudConfig() (string, error) {
+	alias, err := e.Director()
+	if err != nil {
+		return "", err
+	}
+	return e.fetchCloudConfig(alias)
+}
+
+func (e Env) fetchCloudConfig(alias string) (string, error) {
+	b, err := bosh.Director{Environment: alias}.CloudConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(e.CachedDir(), 0777); err != nil {
+		return "", err
+	}
+	if err := writeFile(e.CachedCloudConfig(), b); err != nil {
+		return "", err
+	}
+	return e.CachedCloudConfig(), nil
+}
+
+// The path to the best cloud-config we have for this environment; fresh
+// from the director, unless offline is set (or it can't be reached), in
+// which case the cached copy from last time will have to do.
+func (e Env) CloudConfig(offline bool) (string, error) {
+	if !offline {
+		path, err := e.FetchCloudConfig()
+		if err == nil {
+			return path, nil
+		}
+		if _, serr := os.Stat(e.CachedCloudConfig()); serr != nil {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s; using the cached cloud-config in %s\n", err, e.CachedCloudConfig())
+		return e.CachedCloudConfig(), nil
+	}
+
+	if _, err := os.Stat(e.CachedCloudConfig()); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no cloud-config has been cached for %s (in %s)", e.Name, e.CachedDir())
+		}
+		return "", err
+	}
+	return e.CachedCloudConfig(), nil
+}
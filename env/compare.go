@@ -0,0 +1,51 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/jhunt/genesis/diff"
+)
+
+type CompareOptions struct {
+	CloudConfig string
+	ParamsOnly  bool     // compare merged params, not whole manifests
+	Ignore      []string // paths (or path patterns) that are expected to differ
+}
+
+// the redacted manifest (or merged params) of an environment, parsed
+func (e Env) rendered(opts CompareOptions) (interface{}, error) {
+	k, err := e.Kit()
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	if opts.ParamsOnly {
+		b, err = e.Params(k, opts.CloudConfig, true)
+	} else {
+		b, err = e.Manifest(k, opts.CloudConfig, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := diff.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s manifest: %s", e.Name, err)
+	}
+	return v, nil
+}
+
+// Compare two environments, each with its own kit, returning all of the
+// (unexpected) differences between them, going from a to b.
+func Compare(a, b Env, opts CompareOptions) ([]diff.Change, error) {
+	va, err := a.rendered(opts)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := b.rendered(opts)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Ignore(diff.Compare(va, vb), opts.Ignore), nil
+}
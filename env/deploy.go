@@ -0,0 +1,178 @@
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhunt/genesis/bosh"
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/policy"
+	"github.com/jhunt/genesis/vault"
+)
+
+const CachedManifestFile = "manifest.yml"
+
+type DeployOptions struct {
+	bosh.DeployOptions
+
+	CloudConfig string
+	Director    string // instead of the environment's own (see Env.Director)
+	Vault       vault.Vault
+	Interactive bool
+}
+
+func (e Env) CachedManifest() string {
+	return filepath.Join(e.CachedDir(), CachedManifestFile)
+}
+
+// Deploy this environment: check the kit's prerequisites, make sure all
+// of its credentials exist, merge the (unredacted) manifest, check it
+// against the cloud-config and the repo's policy rules, upload the kit's
+// runtime-config (if it has one), and hand it all to `bosh deploy`.
+// Unless this is a dry run, the outcome is recorded in the deployment
+// ledger, and on success, a redacted copy of what was deployed is kept
+// in .genesis/cached/ENV/manifest.yml.
+func (e Env) Deploy(k kit.Kit, opts DeployOptions) error {
+	features, err := k.Subkits(e.Name, e.Param)
+	if err != nil {
+		return err
+	}
+	hookenv, err := e.HookEnv(features)
+	if err != nil {
+		return err
+	}
+	if k.HasHook(kit.PrereqsHook) {
+		if err := k.ExecHook(kit.PrereqsHook, hookenv, nil, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	missing, err := e.MissingSecrets(k, opts.Vault)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the following credentials are missing from the Vault:\n  - %s\n"+
+			"(try running `genesis secrets %s` first)",
+			strings.Join(missing, "\n  - "), e.Name)
+	}
+
+	alias := opts.Director
+	if alias == "" {
+		if alias, err = e.Director(); err != nil {
+			return err
+		}
+	}
+
+	cloud := opts.CloudConfig
+	if cloud == "" {
+		if cloud, err = e.fetchCloudConfig(alias); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := e.Manifest(k, cloud, false)
+	if err != nil {
+		return err
+	}
+	cc, err := ioutil.ReadFile(cloud)
+	if err != nil {
+		return err
+	}
+	if err := bosh.CheckCloudConfig(manifest, cc); err != nil {
+		return err
+	}
+	violations, err := e.CheckPolicy(k, cloud)
+	if err != nil {
+		return err
+	}
+	for _, v := range violations {
+		if v.Rule.Severity == policy.Warning {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", v)
+		}
+	}
+	if errs := policy.Errors(violations); len(errs) > 0 {
+		return policy.ViolationError{Env: e.Name, Violations: errs}
+	}
+
+	file, err := tempfile("manifest", manifest)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+
+	director := bosh.Director{Environment: alias, Interactive: opts.Interactive}
+
+	if !opts.DryRun {
+		runtime, err := e.RuntimeConfig(k, cloud, false)
+		if err != nil {
+			return err
+		}
+		if runtime != nil {
+			file, err := tempfile("runtime", runtime)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(file)
+			if err := director.UpdateRuntimeConfig(e.Deployment(), file); err != nil {
+				return err
+			}
+		}
+	}
+
+	started := time.Now()
+	err = director.Deploy(e.Deployment(), file, opts.DeployOptions)
+	if opts.DryRun {
+		return err
+	}
+
+	d := Deployment{
+		Time:     started.UTC(),
+		Operator: Operator(),
+		Kit:      "dev",
+		Manifest: Checksum(manifest),
+		Commit:   GitCommit(e.Root),
+		Outcome:  Succeeded,
+		Duration: time.Since(started).Seconds(),
+	}
+	if !k.IsDev {
+		d.Kit, d.Version = k.Name, k.Version
+	}
+	if err != nil {
+		d.Outcome = Failed
+	}
+	if rerr := e.Record(d); rerr != nil {
+		fmt.Fprintf(os.Stderr, "warning: unable to record deployment in %s: %s\n", e.HistoryFile(), rerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	redacted, err := e.Manifest(k, cloud, true)
+	if err != nil {
+		return err
+	}
+	return writeFile(e.CachedManifest(), redacted)
+}
+
+// write sensitive data to a file only we can read
+func tempfile(prefix string, b []byte) (string, error) {
+	f, err := ioutil.TempFile("", "genesis-"+prefix+"-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,137 @@
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jhunt/genesis/bosh"
+	"github.com/jhunt/genesis/diff"
+	"github.com/jhunt/genesis/kit"
+)
+
+type DiffOptions struct {
+	CloudConfig string
+	Cached      bool // don't ask the director; use .genesis/cached/ENV/manifest.yml
+}
+
+// The manifest that is currently deployed, per the BOSH director (or,
+// if it can't be reached, or cached is set, the redacted copy that was
+// kept after the last successful `genesis deploy`).  The second return
+// value is true if it came from the cache.
+func (e Env) Deployed(cached bool) ([]byte, bool, error) {
+	if !cached {
+		alias, err := e.Director()
+		if err != nil {
+			return nil, false, err
+		}
+		director := bosh.Director{Environment: alias}
+		b, err := director.Manifest(e.Deployment())
+		if err == nil {
+			return b, false, nil
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s; falling back to the cached copy\n", err)
+	}
+
+	b, err := ioutil.ReadFile(e.CachedManifest())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, true, fmt.Errorf("%s has not been deployed (no cached manifest found in %s)", e.Name, e.CachedDir())
+		}
+		return nil, true, err
+	}
+	return b, true, nil
+}
+
+// Compare the deployed manifest against what would be deployed now.
+// Credentials are always redacted; if they differ from what the director
+// has, the change is still shown (as REDACTED, on both sides).  What the
+// director has is only shown where the redacted copy kept by the last
+// deploy had it in the clear too; anything else (including everything,
+// if there is no such copy) is redacted, since there's no telling whether
+// or not it was a credential.
+func (e Env) Diff(k kit.Kit, opts DiffOptions) ([]diff.Change, error) {
+	b, cached, err := e.Deployed(opts.Cached)
+	if err != nil {
+		return nil, err
+	}
+	deployed, err := diff.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse deployed manifest: %s", err)
+	}
+
+	cloud := opts.CloudConfig
+	if cloud == "" {
+		// not every kit needs a cloud-config, so do without if we must
+		cloud, _ = e.CloudConfig(cached)
+	}
+
+	b, err = e.Manifest(k, cloud, true)
+	if err != nil {
+		return nil, err
+	}
+	redacted, err := diff.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		return diff.Compare(deployed, redacted), nil
+	}
+
+	// the director has the real credentials, so we need them too, to
+	// know which (if any) will change -- but we only ever show values
+	// from the redacted manifest.
+	b, err = e.Manifest(k, cloud, false)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := diff.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make(map[string]bool)
+	for _, path := range diff.Find(redacted, diff.Redacted) {
+		secret[path] = true
+	}
+
+	var last interface{}
+	if b, err := ioutil.ReadFile(e.CachedManifest()); err == nil {
+		if last, err = diff.Parse(b); err != nil {
+			return nil, fmt.Errorf("unable to parse cached manifest: %s", err)
+		}
+	}
+
+	changes := diff.Compare(deployed, manifest)
+	for i, c := range changes {
+		if c.Kind != diff.Removed {
+			changes[i].New, _ = diff.Get(redacted, c.Path)
+		}
+		if c.Kind != diff.Added && (secret[c.Path] || !plain(c.Old) || !cleartext(last, c.Path)) {
+			changes[i].Old = diff.Redacted
+		}
+	}
+	return changes, nil
+}
+
+// whether the value at path in a redacted manifest is there, and holds
+// no credentials
+func cleartext(doc interface{}, path string) bool {
+	v, ok := diff.Get(doc, path)
+	return ok && plain(v) && len(diff.Find(v, diff.Redacted)) == 0
+}
+
+// scalars, and lists of scalars
+func plain(v interface{}) bool {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		return false
+	case []interface{}:
+		for _, sub := range x {
+			if !plain(sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
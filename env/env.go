@@ -0,0 +1,176 @@
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type Env struct {
+	Name string
+	Root string
+}
+
+type NotFoundError struct {
+	Name string
+}
+
+func (e NotFoundError) Error() string {
+	return "Environment " + e.Name + " not found"
+}
+
+func IsNotFound(e error) bool {
+	_, ok := e.(NotFoundError)
+	return ok
+}
+
+func Load(root, name string) (Env, error) {
+	e := Env{
+		Name: strings.TrimSuffix(filepath.Base(name), ".yml"),
+		Root: root,
+	}
+	if _, err := os.Stat(e.File()); err != nil {
+		if os.IsNotExist(err) {
+			return e, NotFoundError{Name: e.Name}
+		}
+		return e, err
+	}
+	return e, nil
+}
+
+// the file that defines this environment, i.e. us-west-1-sandbox.yml
+func (e Env) File() string {
+	return filepath.Join(e.Root, e.Name+".yml")
+}
+
+// all of the YAML files (that exist) which make up this environment,
+// from least specific (us.yml) to most specific (us-west-1-sandbox.yml)
+func (e Env) Files() []string {
+	l := make([]string, 0)
+	parts := strings.Split(e.Name, "-")
+	for i := range parts {
+		path := filepath.Join(e.Root, strings.Join(parts[0:i+1], "-")+".yml")
+		if _, err := os.Stat(path); err == nil {
+			l = append(l, path)
+		}
+	}
+	return l
+}
+
+func (e Env) Lookup(key string) (interface{}, bool, error) {
+	v, source, err := e.lookup(key)
+	return v, source != "", err
+}
+
+// which file in the hierarchy (most specific wins) sets the given key,
+// or the empty string if none of them do
+func (e Env) Source(key string) (string, error) {
+	_, source, err := e.lookup(key)
+	return source, err
+}
+
+func (e Env) lookup(key string) (interface{}, string, error) {
+	var (
+		value  interface{}
+		source string
+	)
+
+	files := e.Files()
+	docs, err := e.docs()
+	if err != nil {
+		return nil, "", err
+	}
+	for i, doc := range docs {
+		if v, ok := dig(doc, key); ok {
+			value, source = v, files[i]
+		}
+	}
+	return value, source, nil
+}
+
+// the parsed contents of each of e.Files(), in order
+func (e Env) docs() ([]interface{}, error) {
+	l := make([]interface{}, 0)
+	for _, file := range e.Files() {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc interface{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		l = append(l, doc)
+	}
+	return l, nil
+}
+
+func (e Env) Param(name string) (interface{}, bool, error) {
+	return e.Lookup("params." + name)
+}
+
+// the name of the deployments repo, without the -deployments suffix,
+// or $GENESIS_TYPE, for checkouts that aren't named after their repo
+// (i.e. in a Concourse pipeline)
+func (e Env) Type() string {
+	if s := os.Getenv("GENESIS_TYPE"); s != "" {
+		return s
+	}
+	root, err := filepath.Abs(e.Root)
+	if err != nil {
+		root = e.Root
+	}
+	return strings.TrimSuffix(filepath.Base(root), "-deployments")
+}
+
+// where this environment's credentials live in the Vault (under secret/),
+// either explicitly set as params.vault, or derived from the names of the
+// environment and the deployments repo: us-west-1-prod-shield-deployments
+// becomes us/west/1/prod/shield.
+func (e Env) VaultPrefix() (string, error) {
+	v, found, err := e.Param("vault")
+	if err != nil {
+		return "", err
+	}
+	if found && v != nil {
+		return fmt.Sprintf("%v", v), nil
+	}
+	return DefaultVaultPrefix(e.Name, e.Type()), nil
+}
+
+// the BOSH director (alias) this environment deploys to; params.bosh,
+// or the name of the environment itself.
+func (e Env) Director() (string, error) {
+	v, found, err := e.Param("bosh")
+	if err != nil || !found || v == nil {
+		return e.Name, err
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// the name of the BOSH deployment, i.e. us-west-1-prod-shield
+func (e Env) Deployment() string {
+	return e.Name + "-" + e.Type()
+}
+
+func DefaultVaultPrefix(name, kind string) string {
+	return strings.Replace(name, "-", "/", -1) + "/" + strings.Replace(kind, "-", "/", -1)
+}
+
+func dig(doc interface{}, key string) (interface{}, bool) {
+	for _, k := range strings.Split(key, ".") {
+		m, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,205 @@
+package env
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhunt/genesis/report"
+)
+
+const (
+	HistoryFile = "history"
+
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+// A Deployment is a single entry in an environment's deployment ledger,
+// .genesis/cached/ENV/history, which holds one JSON object per line,
+// oldest first.  The ledger is only ever appended to.
+type Deployment struct {
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	Kit      string    `json:"kit"`
+	Version  string    `json:"version"`
+	Manifest string    `json:"manifest"` // sha1 of the (unredacted) manifest
+	Commit   string    `json:"commit"`   // git commit of the deployments repo
+	Outcome  string    `json:"outcome"`  // succeeded / failed
+	Duration float64   `json:"duration"` // in seconds
+}
+
+func (e Env) HistoryFile() string {
+	return filepath.Join(e.CachedDir(), HistoryFile)
+}
+
+func (e Env) History() ([]Deployment, error) {
+	l := make([]Deployment, 0)
+
+	f, err := os.Open(e.HistoryFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var d Deployment
+		if err := json.Unmarshal(s.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("%s, line %d: %s", e.HistoryFile(), n, err)
+		}
+		l = append(l, d)
+	}
+	return l, s.Err()
+}
+
+// Append a deployment to the ledger.  Successful deployments also
+// update .genesis/cached/ENV/last, for older versions of Genesis.
+func (e Env) Record(d Deployment) error {
+	if err := os.MkdirAll(e.CachedDir(), 0777); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(e.HistoryFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if d.Outcome == Succeeded {
+		last := []byte(strconv.FormatInt(d.Time.Unix(), 10) + "\n")
+		return writeFile(filepath.Join(e.CachedDir(), "last"), last)
+	}
+	return nil
+}
+
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Who is deploying; $GENESIS_OPERATOR if set, otherwise the local user.
+func Operator() string {
+	if s := os.Getenv("GENESIS_OPERATOR"); s != "" {
+		return s
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// The current commit of the deployments repo at root (with a trailing
+// + if there are uncommitted changes), or the empty string if it isn't
+// a git repository.
+func GitCommit(root string) string {
+	b, err := exec.Command("git", "-C", root, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(b))
+	if exec.Command("git", "-C", root, "diff", "--quiet", "HEAD").Run() != nil {
+		commit += "+"
+	}
+	return commit
+}
+
+func Checksum(manifest []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(manifest))
+}
+
+func HistoryColumns() []report.Column {
+	format := os.Getenv("GENESIS_TIME_FORMAT")
+	if format == "" {
+		format = DefaultTimeFormat
+	}
+	short := func(n int) func(v interface{}) string {
+		return func(v interface{}) string {
+			s := fmt.Sprintf("%v", v)
+			if len(s) > n {
+				return s[:n]
+			}
+			return s
+		}
+	}
+
+	return []report.Column{
+		{Key: "time", Header: "Deployed", Display: func(v interface{}) string {
+			return report.Strftime(format, v.(time.Time))
+		}},
+		{Key: "operator", Header: "Operator"},
+		{Key: "kit", Header: "Kit/Version"},
+		{Key: "outcome", Header: "Outcome"},
+		{Key: "duration", Header: "Duration", Display: func(v interface{}) string {
+			return time.Duration(v.(float64) * float64(time.Second)).Round(time.Second).String()
+		}},
+		{Key: "manifest", Header: "Manifest", Display: short(10)},
+		{Key: "commit", Header: "Commit", Display: short(10)},
+	}
+}
+
+// A report on (up to limit of) the most recent deployments, newest first.
+func (e Env) HistoryReport(limit int) (report.Report, error) {
+	l, err := e.History()
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	r := report.Report{Columns: HistoryColumns()}
+	for i := len(l) - 1; i >= 0; i-- {
+		if limit > 0 && len(r.Rows) >= limit {
+			break
+		}
+		d := l[i]
+		kit := d.Kit
+		if d.Version != "" {
+			kit += "/" + d.Version
+		}
+		r.Rows = append(r.Rows, report.Row{Values: map[string]interface{}{
+			"time":     d.Time.Local(),
+			"operator": d.Operator,
+			"kit":      kit,
+			"outcome":  d.Outcome,
+			"duration": d.Duration,
+			"manifest": d.Manifest,
+			"commit":   d.Commit,
+		}})
+	}
+	return r, nil
+}
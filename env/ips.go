@@ -0,0 +1,382 @@
+package env
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/genesis/bosh"
+	"github.com/jhunt/genesis/report"
+	"gopkg.in/yaml.v2"
+)
+
+// A StaticIPRequest, from params.static_ips, asks Genesis to set aside
+// Count static IPs on a network (optionally, only from subnets in some
+// AZs) for an instance group.  Unless an Offset into the network's pool
+// of static IPs is given, one is derived from the environment and job
+// names, so that the same environment always gets the same IPs.  Kits
+// use them via (( grab meta.static_ips.JOB )).
+type StaticIPRequest struct {
+	Job     string   `yaml:"job"`
+	Network string   `yaml:"network"`
+	Count   int      `yaml:"count"`
+	AZs     []string `yaml:"azs"`
+	Offset  *int     `yaml:"offset"`
+}
+
+// An Allocation of static IPs, to an instance group of an environment.
+type Allocation struct {
+	Env     string
+	Job     string
+	Network string
+	IPs     []string
+}
+
+// A StaticIPError lists all of the static IPs that have been allocated
+// to more than one instance group (in one or more environments).
+type StaticIPError struct {
+	Collisions []string
+}
+
+func (e StaticIPError) Error() string {
+	return "the following static IPs are allocated more than once:\n  - " + strings.Join(e.Collisions, "\n  - ")
+}
+
+func (e Env) StaticIPRequests() ([]StaticIPRequest, error) {
+	v, found, err := e.Param("static_ips")
+	if err != nil || !found || v == nil {
+		return nil, err
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var l []StaticIPRequest
+	if err := yaml.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("%s: params.static_ips is malformed: %s", e.Name, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range l {
+		if r.Job == "" || r.Network == "" || r.Count < 1 {
+			return nil, fmt.Errorf("%s: params.static_ips entries need a job, a network and a count (of at least 1)", e.Name)
+		}
+		if seen[r.Job] {
+			return nil, fmt.Errorf("%s: params.static_ips lists job '%s' more than once", e.Name, r.Job)
+		}
+		seen[r.Job] = true
+	}
+	return l, nil
+}
+
+// The static IPs that an instance group had on a network when this
+// environment was last deployed (from the cached manifest), if any.
+func (e Env) DeployedStaticIPs(job, network string) []string {
+	b, err := ioutil.ReadFile(e.CachedManifest())
+	if err != nil {
+		return nil
+	}
+
+	type group struct {
+		Name     string `yaml:"name"`
+		Networks []struct {
+			Name      string   `yaml:"name"`
+			StaticIPs []string `yaml:"static_ips"`
+		} `yaml:"networks"`
+	}
+	var m struct {
+		Jobs           []group `yaml:"jobs"`
+		InstanceGroups []group `yaml:"instance_groups"`
+	}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	for _, g := range append(m.InstanceGroups, m.Jobs...) {
+		if g.Name != job {
+			continue
+		}
+		for _, n := range g.Networks {
+			if n.Name == network {
+				return n.StaticIPs
+			}
+		}
+	}
+	return nil
+}
+
+// Allocate the static IPs that a set of environments (which share a
+// director, and so its networks) ask for, each from its own cloud-config
+// (by environment name).  Explicit offsets are honored as given, and
+// deployed environments keep the static IPs they were deployed with, as
+// long as those still fit.  Every other request gets a contiguous run of
+// IPs, as close as possible after an offset derived from the environment
+// and job names, skipping past any that are already taken; environments
+// are allocated for in order of their names.
+func AllocateStaticIPs(envs []Env, clouds map[string][]byte) ([]Allocation, error) {
+	type request struct {
+		env      string
+		req      StaticIPRequest
+		pool     []string
+		deployed []string
+	}
+
+	sorted := append([]Env{}, envs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var all, fixed, kept, hashed []request
+	for _, e := range sorted {
+		reqs, err := e.StaticIPRequests()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range reqs {
+			pool, err := bosh.StaticIPs(clouds[e.Name], r.Network, r.AZs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: unable to allocate static IPs for %s: %s", e.Name, r.Job, err)
+			}
+			if len(pool) < r.Count {
+				return nil, fmt.Errorf("%s: unable to allocate %d static IPs for %s; network '%s' only has %d",
+					e.Name, r.Count, r.Job, r.Network, len(pool))
+			}
+
+			x := request{env: e.Name, req: r, pool: pool}
+			all = append(all, x)
+			if r.Offset == nil {
+				if x.deployed = e.DeployedStaticIPs(r.Job, r.Network); fits(x.deployed, r.Count, pool) {
+					kept = append(kept, x)
+				} else {
+					hashed = append(hashed, x)
+				}
+				continue
+			}
+			if *r.Offset < 0 || *r.Offset+r.Count > len(pool) {
+				return nil, fmt.Errorf("%s: unable to allocate %d static IPs for %s at offset %d; network '%s' only has %d",
+					e.Name, r.Count, r.Job, *r.Offset, r.Network, len(pool))
+			}
+			fixed = append(fixed, x)
+		}
+	}
+
+	taken := make(map[string]bool)
+	allocs := make(map[string]Allocation)
+	allocate := func(x request, ips []string) {
+		a := Allocation{Env: x.env, Job: x.req.Job, Network: x.req.Network}
+		a.IPs = append([]string{}, ips...)
+		for _, ip := range a.IPs {
+			taken[a.Network+" "+ip] = true
+		}
+		allocs[x.env+"/"+x.req.Job] = a
+	}
+	free := func(x request, offset int) bool {
+		if offset+x.req.Count > len(x.pool) {
+			return false
+		}
+		for _, ip := range x.pool[offset : offset+x.req.Count] {
+			if taken[x.req.Network+" "+ip] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, x := range fixed {
+		allocate(x, x.pool[*x.req.Offset:*x.req.Offset+x.req.Count])
+	}
+	// moving deployed static IPs around would break the deployment
+	for _, x := range kept {
+		allocate(x, x.deployed)
+	}
+	for _, x := range hashed {
+		h := fnv.New32a()
+		h.Write([]byte(x.env + "/" + x.req.Job))
+		start := int(h.Sum32() % uint32(len(x.pool)))
+
+		offset := -1
+		for i := 0; i < len(x.pool) && offset < 0; i++ {
+			if free(x, (start+i)%len(x.pool)) {
+				offset = (start + i) % len(x.pool)
+			}
+		}
+		if offset < 0 {
+			return nil, fmt.Errorf("%s: unable to allocate %d static IPs for %s; network '%s' doesn't have that many left in a row",
+				x.env, x.req.Count, x.req.Job, x.req.Network)
+		}
+		allocate(x, x.pool[offset:offset+x.req.Count])
+	}
+
+	l := make([]Allocation, 0, len(all))
+	for _, x := range all {
+		l = append(l, allocs[x.env+"/"+x.req.Job])
+	}
+	return l, nil
+}
+
+// whether or not previously deployed static IPs still fit a request
+func fits(ips []string, count int, pool []string) bool {
+	if len(ips) != count {
+		return false
+	}
+	in := make(map[string]bool)
+	for _, ip := range pool {
+		in[ip] = true
+	}
+	for _, ip := range ips {
+		if !in[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+// Allocate static IPs for this environment, along with every other
+// environment in the repository that deploys to the same director (and
+// so shares its networks), so that none of them collide.  The others
+// allocate from the cloud-config cached when they were last deployed,
+// if there is one, and from this one if not.
+func (e Env) CheckStaticIPs(cloud []byte) ([]Allocation, error) {
+	reqs, err := e.StaticIPRequests()
+	if err != nil || len(reqs) == 0 {
+		return nil, err
+	}
+
+	director, err := e.Director()
+	if err != nil {
+		return nil, err
+	}
+	all, err := All(e.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := []Env{e}
+	clouds := map[string][]byte{e.Name: cloud}
+	for _, other := range all {
+		if other.Name == e.Name {
+			continue
+		}
+		if d, err := other.Director(); err != nil || d != director {
+			continue
+		}
+		clouds[other.Name] = cloud
+		if path, err := other.CloudConfig(true); err == nil {
+			if b, err := ioutil.ReadFile(path); err == nil {
+				clouds[other.Name] = b
+			}
+		}
+		envs = append(envs, other)
+	}
+
+	l, err := AllocateStaticIPs(envs, clouds)
+	if err != nil {
+		return nil, err
+	}
+	// explicit offsets (and different cloud-configs) can still collide
+	if err := Collisions(l, e.Name); err != nil {
+		return nil, err
+	}
+
+	mine := make([]Allocation, 0, len(reqs))
+	for _, a := range l {
+		if a.Env == e.Name {
+			mine = append(mine, a)
+		}
+	}
+	return mine, nil
+}
+
+// Check a set of allocations for static IPs handed out more than once
+// on the same network; if env is not empty, only collisions involving
+// that environment are reported.
+func Collisions(l []Allocation, env string) error {
+	owners := make(map[string][]Allocation)
+	for _, a := range l {
+		for _, ip := range a.IPs {
+			key := a.Network + " " + ip
+			owners[key] = append(owners[key], a)
+		}
+	}
+
+	collisions := make([]string, 0)
+	for key, by := range owners {
+		if len(by) < 2 {
+			continue
+		}
+		involved := env == ""
+		names := make([]string, len(by))
+		for i, a := range by {
+			names[i] = a.Env + "/" + a.Job
+			involved = involved || a.Env == env
+		}
+		if involved {
+			net := strings.SplitN(key, " ", 2)
+			collisions = append(collisions, fmt.Sprintf("%s (network %s): %s", net[1], net[0], strings.Join(names, ", ")))
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return StaticIPError{Collisions: collisions}
+	}
+	return nil
+}
+
+// the YAML that makes allocations available to kits, via meta.static_ips
+func staticIPsOverlay(l []Allocation) ([]byte, error) {
+	ips := make(map[string][]string)
+	for _, a := range l {
+		ips[a.Job] = a.IPs
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"meta": map[string]interface{}{
+			"static_ips": ips,
+		},
+	})
+}
+
+// A report on the static IPs allocated to a set of environments, each
+// allocated from its own cloud-config.
+func StaticIPReport(l []Env, offline bool) (report.Report, error) {
+	r := report.Report{Columns: []report.Column{
+		{Key: "env", Header: "Environment"},
+		{Key: "job", Header: "Job"},
+		{Key: "network", Header: "Network"},
+		{Key: "ips", Header: "Static IPs", Display: func(v interface{}) string {
+			return strings.Join(v.([]string), ", ")
+		}},
+	}}
+
+	for _, e := range l {
+		reqs, err := e.StaticIPRequests()
+		if err != nil {
+			return r, err
+		}
+		if len(reqs) == 0 {
+			continue
+		}
+
+		path, err := e.CloudConfig(offline)
+		if err != nil {
+			return r, err
+		}
+		cloud, err := ioutil.ReadFile(path)
+		if err != nil {
+			return r, err
+		}
+		allocs, err := e.CheckStaticIPs(cloud)
+		if err != nil {
+			return r, err
+		}
+		for _, a := range allocs {
+			r.Rows = append(r.Rows, report.Row{Values: map[string]interface{}{
+				"env":     a.Env,
+				"job":     a.Job,
+				"network": a.Network,
+				"ips":     a.IPs,
+			}})
+		}
+	}
+	return r, nil
+}
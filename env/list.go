@@ -0,0 +1,71 @@
+package env
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// All of the deployable environments in the deployments repo at root,
+// sorted by name.  Environments are the .yml files at the top of the
+// repo that nothing else inherits from (client-aws-1-prod.yml, but not
+// client-aws.yml), and that set params.env somewhere in their hierarchy.
+func All(root string) ([]Env, error) {
+	files, err := filepath.Glob(filepath.Join(root, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(filepath.Base(file), ".yml")
+	}
+	sort.Strings(names)
+
+	l := make([]Env, 0)
+	for _, name := range names {
+		if inherited(name, names) {
+			continue
+		}
+
+		e := Env{Name: name, Root: root}
+		if _, found, err := e.Param("env"); err != nil {
+			return nil, err
+		} else if found {
+			l = append(l, e)
+		}
+	}
+	return l, nil
+}
+
+func inherited(name string, names []string) bool {
+	for _, other := range names {
+		if strings.HasPrefix(other, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter a list of environments down to those whose names match at
+// least one of the given shell globs; no globs means no filtering.
+func Filter(l []Env, globs []string) ([]Env, error) {
+	if len(globs) == 0 {
+		return l, nil
+	}
+
+	keep := make([]Env, 0)
+	for _, e := range l {
+		for _, glob := range globs {
+			ok, err := filepath.Match(strings.TrimSuffix(glob, ".yml"), e.Name)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				keep = append(keep, e)
+				break
+			}
+		}
+	}
+	return keep, nil
+}
@@ -0,0 +1,294 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhunt/genesis/bosh"
+	"github.com/jhunt/genesis/diff"
+	"github.com/jhunt/genesis/kit"
+	"gopkg.in/yaml.v2"
+)
+
+// top-level keys of a BOSH cloud-config, which are merged in so that
+// operators like (( static_ips ... )) work, but then pruned back out
+var CloudConfigKeys = []string{
+	"azs",
+	"compilation",
+	"disk_types",
+	"networks",
+	"vm_extensions",
+	"vm_types",
+}
+
+func (e Env) Kit() (kit.Kit, error) {
+	name, _, err := e.Param("kit")
+	if err != nil {
+		return kit.Kit{}, err
+	}
+	version, _, err := e.Param("version")
+	if err != nil {
+		return kit.Kit{}, err
+	}
+
+	if name == nil || name == "dev" {
+		return kit.DevKitIn(e.Root)
+	}
+	// FIXME: kit.LatestNamedKit and kit.CompiledKit aren't there yet
+	if version == nil {
+		version = "latest"
+	}
+	return kit.Kit{}, fmt.Errorf("environment %s uses the %v/%v kit, but compiled kits are not supported yet (only dev/ kits are)", e.Name, name, version)
+}
+
+func (e Env) HookEnv(features []string) (kit.HookEnv, error) {
+	prefix, err := e.VaultPrefix()
+	if err != nil {
+		return kit.HookEnv{}, err
+	}
+	return kit.HookEnv{
+		Root:        e.Root,
+		Environment: e.Name,
+		VaultPrefix: prefix,
+		Features:    features,
+	}, nil
+}
+
+// merge the kit (with whatever subkits this environment activates),
+// the cloud-config and the environment hierarchy, via spruce, and then
+// apply any ops-files from the kit and the environment
+func (e Env) Manifest(k kit.Kit, cloud string, redact bool) ([]byte, error) {
+	return e.merge(k, cloud, redact, true, "--prune", "meta", "--prune", "params")
+}
+
+// just the params of the environment, as merged with the kit
+func (e Env) Params(k kit.Kit, cloud string, redact bool) ([]byte, error) {
+	return e.merge(k, cloud, redact, false, "--cherry-pick", "params")
+}
+
+func (e Env) merge(k kit.Kit, cloud string, redact, ops bool, flags ...string) ([]byte, error) {
+	subkits, err := k.Subkits(e.Name, e.Param)
+	if err != nil {
+		return nil, err
+	}
+
+	hookenv, err := e.HookEnv(subkits)
+	if err != nil {
+		return nil, err
+	}
+	if k.HasHook(kit.CheckHook) {
+		if _, err := k.RunHook(kit.CheckHook, hookenv, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	if k.HasHook(kit.BlueprintHook) {
+		out, err := k.RunHook(kit.BlueprintHook, hookenv, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range strings.Split(out, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, filepath.Join(k.Root(), file))
+			}
+		}
+	} else {
+		files, err = k.Files(subkits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args := append([]string{"merge"}, flags...)
+	if cloud != "" {
+		for _, key := range CloudConfigKeys {
+			args = append(args, "--prune", key)
+		}
+		args = append(args, cloud)
+	}
+	args = append(args, files...)
+	args = append(args, e.Files()...)
+
+	reqs, err := e.StaticIPRequests()
+	if err != nil {
+		return nil, err
+	}
+	if len(reqs) > 0 {
+		if cloud == "" {
+			return nil, fmt.Errorf("%s asks for static IPs (via params.static_ips), but no cloud-config was given", e.Name)
+		}
+		b, err := ioutil.ReadFile(cloud)
+		if err != nil {
+			return nil, err
+		}
+		allocs, err := e.CheckStaticIPs(b)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = staticIPsOverlay(allocs); err != nil {
+			return nil, err
+		}
+		overlay, err := tempfile("static-ips", b)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(overlay)
+		args = append(args, overlay)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("spruce", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if redact {
+		cmd.Env = append(cmd.Env, "REDACT=yes")
+	} else {
+		cmd.Env = append(cmd.Env, "REDACT=")
+	}
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to merge %s manifest: %s", e.Name,
+			strings.TrimSpace(stderr.String()))
+	}
+	if !ops {
+		return stdout.Bytes(), nil
+	}
+
+	l, err := k.OpsFiles(subkits)
+	if err != nil {
+		return nil, err
+	}
+	more, err := e.OpsFiles()
+	if err != nil {
+		return nil, err
+	}
+	return bosh.ApplyOpsFiles(stdout.Bytes(), append(l, more...))
+}
+
+// The ops-files that this environment applies, after the kit's.  Any
+// file in the hierarchy can list some (relative to the top of the repo)
+// in params.ops_files; they are applied least-specific file first.
+func (e Env) OpsFiles() ([]string, error) {
+	docs, err := e.docs()
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]string, 0)
+	for i, doc := range docs {
+		v, ok := dig(doc, "params.ops_files")
+		if !ok || v == nil {
+			continue
+		}
+		files, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: params.ops_files must be a list of files", e.Files()[i])
+		}
+		for _, file := range files {
+			path := fmt.Sprintf("%v", file)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(e.Root, path)
+			}
+			l = append(l, path)
+		}
+	}
+	return l, nil
+}
+
+// Merge the kit's runtime-config fragments for this environment (with
+// its params, so that they can be grabbed); returns nil if there are none.
+func (e Env) RuntimeConfig(k kit.Kit, cloud string, redact bool) ([]byte, error) {
+	subkits, err := k.Subkits(e.Name, e.Param)
+	if err != nil {
+		return nil, err
+	}
+	files, err := k.RuntimeFiles(subkits)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	b, err := e.Params(k, cloud, redact)
+	if err != nil {
+		return nil, err
+	}
+	params, err := tempfile("params", b)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(params)
+
+	args := append([]string{"merge", "--prune", "meta", "--prune", "params", params}, files...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("spruce", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if redact {
+		cmd.Env = append(cmd.Env, "REDACT=yes")
+	} else {
+		cmd.Env = append(cmd.Env, "REDACT=")
+	}
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to merge %s runtime-config: %s", e.Name,
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+var ManifestFormats = []string{"yaml", "json"}
+
+// Reformat a manifest (or just the part of it at a spruce-style path,
+// i.e. `jobs.consul.properties`) as YAML or JSON.
+func Format(manifest []byte, path, format string) ([]byte, error) {
+	doc, err := diff.Parse(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		v, ok := diff.Get(doc, path)
+		if !ok {
+			return nil, fmt.Errorf("'%s' not found in the manifest", path)
+		}
+		doc = v
+	}
+
+	switch format {
+	case "", "yaml":
+		return yaml.Marshal(doc)
+	case "json":
+		b, err := json.MarshalIndent(jsonable(doc), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return nil, fmt.Errorf("unrecognized output format '%s' (must be one of %s)", format, strings.Join(ManifestFormats, ", "))
+}
+
+// YAML maps can have keys of any type; JSON objects can't
+func jsonable(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, sub := range x {
+			m[fmt.Sprintf("%v", k)] = jsonable(sub)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, sub := range x {
+			l[i] = jsonable(sub)
+		}
+		return l
+	}
+	return v
+}
@@ -0,0 +1,206 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/vault"
+	"gopkg.in/yaml.v2"
+)
+
+func ValidName(s string) bool {
+	ok, err := regexp.MatchString(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`, s)
+	return err == nil && ok
+}
+
+type NewOptions struct {
+	Vault     vault.Vault
+	NoSecrets bool
+
+	// answers to the kit's params; if Yes is set, nothing is asked
+	// interactively, and any required params not answered (and with no
+	// default) cause Create to fail before anything else happens.
+	Answers Answers
+	Yes     bool
+	In      io.Reader
+	Out     io.Writer
+}
+
+// Create a brand new environment file, after making sure the kit's
+// prerequisites are met, asking the operator for the params the kit
+// needs, and generating its credentials.
+//
+// This is all or nothing: if any step fails, every credential that was
+// created along the way is deleted from the Vault again, the environment
+// file is never written, secret params that were already in the Vault
+// get their old values back, and a RollbackError explains what was undone.
+// (Credentials written by the kit's own secrets hook are not tracked.)
+func Create(root, name string, k kit.Kit, opts NewOptions) (e Env, err error) {
+	name = strings.TrimSuffix(name, ".yml")
+	if !ValidName(name) {
+		return Env{}, fmt.Errorf("'%s' is not a valid environment name", name)
+	}
+	if opts.In == nil {
+		opts.In = os.Stdin
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+
+	e = Env{Name: name, Root: root}
+	if _, err := os.Stat(e.File()); err == nil {
+		return e, fmt.Errorf("%s already exists; refusing to overwrite it", e.File())
+	}
+
+	hookenv, err := e.HookEnv(nil)
+	if err != nil {
+		return e, err
+	}
+
+	var values Answers
+	if opts.Yes {
+		if values, err = e.Ask(k, opts.Answers, opts.In, opts.Out, true); err != nil {
+			return e, err
+		}
+	}
+
+	if k.HasHook(kit.PrereqsHook) {
+		if err := k.ExecHook(kit.PrereqsHook, hookenv, nil, opts.Out); err != nil {
+			return e, err
+		}
+	}
+
+	if !opts.Yes {
+		if values, err = e.Ask(k, opts.Answers, opts.In, opts.Out, false); err != nil {
+			return e, err
+		}
+	}
+
+	tx := newTransaction(opts.Vault)
+	defer func() {
+		if err != nil {
+			err = tx.rollback(err)
+		}
+	}()
+
+	if !opts.NoSecrets {
+		written, err := e.Secrets(k, opts.Vault, nil, false)
+		tx.created(written...)
+		if err != nil {
+			return e, err
+		}
+	}
+	for _, p := range k.Params {
+		v, ok := values[p.Name]
+		if !ok || !p.Secret {
+			continue
+		}
+		path := e.paramPath(hookenv.VaultPrefix, p)
+		if opts.NoSecrets {
+			fmt.Fprintf(opts.Out, "not storing %s in the Vault (--no-secrets); put it in %s:value yourself\n", p.Name, path)
+			continue
+		}
+		existed := opts.Vault.Exists(path + ":value")
+		if existed {
+			old, err := opts.Vault.Get(path, "value")
+			if err != nil {
+				return e, err
+			}
+			tx.overwriting(path, "value", old)
+		}
+		if err := opts.Vault.Set(path, "value", fmt.Sprintf("%v", v)); err != nil {
+			return e, err
+		}
+		if !existed {
+			tx.created(path + ":value")
+		}
+	}
+
+	var body string
+	if k.HasHook(kit.NewHook) {
+		if body, err = k.RunHook(kit.NewHook, hookenv, opts.In); err != nil {
+			return e, err
+		}
+	} else {
+		if body, err = e.defaultBody(k, hookenv.VaultPrefix, values); err != nil {
+			return e, err
+		}
+	}
+
+	if err := tx.stage(e.File(), []byte(body)); err != nil {
+		return e, err
+	}
+	if err := tx.commit(); err != nil {
+		return e, err
+	}
+
+	// the environment exists now; a failing info hook is not worth
+	// throwing it all away for.
+	if k.HasHook(kit.InfoHook) {
+		if err := k.ExecHook(kit.InfoHook, hookenv, nil, opts.Out); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		}
+	}
+	return e, nil
+}
+
+// where secret params are kept in the Vault
+func (e Env) paramPath(prefix string, p kit.Param) string {
+	return "secret/" + strings.Trim(prefix, "/") + "/params/" + p.Name
+}
+
+func (e Env) defaultBody(k kit.Kit, prefix string, values Answers) (string, error) {
+	params := [][]string{}
+	if !k.IsDev {
+		params = append(params, []string{"kit", k.Name}, []string{"version", k.Version})
+	}
+	params = append(params, []string{"env", e.Name}, []string{"vault", prefix})
+
+	n := 0
+	for _, p := range params {
+		if len(p[0]) > n {
+			n = len(p[0])
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("params:\n")
+	for _, p := range params {
+		fmt.Fprintf(&b, "  %-*s %s\n", n+1, p[0]+":", p[1])
+	}
+
+	for _, p := range k.Params {
+		v, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+
+		b.WriteString("\n")
+		if p.Description != "" {
+			for _, line := range strings.Split(strings.TrimSpace(p.Description), "\n") {
+				b.WriteString(strings.TrimRight("  # "+line, " ") + "\n")
+			}
+		}
+
+		if p.Secret {
+			fmt.Fprintf(&b, "  %s: (( vault \"%s:value\" ))\n", p.Name, e.paramPath(prefix, p))
+			continue
+		}
+
+		y, err := yaml.Marshal(map[string]interface{}{p.Name: v})
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(y), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n")
+	return b.String(), nil
+}
@@ -0,0 +1,21 @@
+package env
+
+import (
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/policy"
+)
+
+// Check this environment's (redacted) manifest against the policy rules
+// of its deployments repo.
+func (e Env) CheckPolicy(k kit.Kit, cloud string) ([]policy.Violation, error) {
+	p, err := policy.Load(e.Root)
+	if err != nil || len(p.Rules) == 0 {
+		return nil, err
+	}
+
+	b, err := e.Manifest(k, cloud, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.Check(e.Name, b)
+}
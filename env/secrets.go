@@ -0,0 +1,82 @@
+package env
+
+import (
+	"os"
+
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/vault"
+)
+
+// Generate (or, with rotate, re-generate) all of the credentials the kit
+// declares, and then hand off to the kit's secrets hook, if it has one.
+// Returns the Vault paths of the credentials that were written.
+func (e Env) Secrets(k kit.Kit, v vault.Vault, features []string, rotate bool) ([]string, error) {
+	prefix, err := e.VaultPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := k.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) > 0 || k.HasHook(kit.SecretsHook) {
+		if err := v.Ping(); err != nil {
+			return nil, err
+		}
+	}
+
+	written := make([]string, 0)
+	for _, s := range secrets {
+		ok, err := v.Generate(prefix, s, rotate)
+		if err != nil {
+			return written, err
+		}
+		if ok {
+			written = append(written, vault.Ref(prefix, s))
+		}
+	}
+
+	if k.HasHook(kit.SecretsHook) {
+		hookenv, err := e.HookEnv(features)
+		if err != nil {
+			return written, err
+		}
+		action := "add"
+		if rotate {
+			action = "rotate"
+		}
+		if err := k.ExecHook(kit.SecretsHook, hookenv, nil, os.Stdout, action); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// Which of the credentials the kit declares are missing from the Vault.
+func (e Env) MissingSecrets(k kit.Kit, v vault.Vault) ([]string, error) {
+	prefix, err := e.VaultPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := k.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+	if err := v.Ping(); err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0)
+	for _, s := range secrets {
+		if !v.Exists(vault.Ref(prefix, s)) {
+			missing = append(missing, vault.Ref(prefix, s))
+		}
+	}
+	return missing, nil
+}
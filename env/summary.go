@@ -0,0 +1,147 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/report"
+)
+
+const DefaultTimeFormat = "%Y-%m-%d %H:%M:%S %Z"
+
+var DefaultSummaryColumns = []string{"env", "kit", "last"}
+
+// All of the columns that `genesis summary` knows how to report on.
+func SummaryColumns() []report.Column {
+	format := os.Getenv("GENESIS_TIME_FORMAT")
+	if format == "" {
+		format = DefaultTimeFormat
+	}
+
+	return []report.Column{
+		{Key: "env", Header: "Environment"},
+		{Key: "kit", Header: "Kit/Version"},
+		{Key: "name", Header: "Kit"},
+		{Key: "constraint", Header: "Version (requested)"},
+		{Key: "resolved", Header: "Version (resolved)"},
+		{Key: "last", Header: "Last Deployed", Display: func(v interface{}) string {
+			if t, ok := v.(time.Time); ok {
+				return report.Strftime(format, t)
+			}
+			return "never"
+		}},
+		{Key: "age", Header: "Days Since Deploy", Display: func(v interface{}) string {
+			if v == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%v", v)
+		}},
+		{Key: "director", Header: "BOSH Director"},
+		{Key: "vault", Header: "Vault Prefix"},
+		{Key: "upgrade", Header: "Upgrade Available", Display: func(v interface{}) string {
+			if v == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%v", v)
+		}},
+	}
+}
+
+// Build a report on the given environments, grouped by params.site.
+func Summary(l []Env, columns []string) (report.Report, error) {
+	cols, err := report.Select(SummaryColumns(), columns)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	r := report.Report{Columns: cols}
+	for _, e := range l {
+		row, err := e.summarize()
+		if err != nil {
+			return r, fmt.Errorf("%s: %s", e.Name, err)
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	sort.SliceStable(r.Rows, func(i, j int) bool {
+		if r.Rows[i].Group != r.Rows[j].Group {
+			return r.Rows[i].Group < r.Rows[j].Group
+		}
+		return r.Rows[i].Values["env"].(string) < r.Rows[j].Values["env"].(string)
+	})
+	return r, nil
+}
+
+func (e Env) summarize() (report.Row, error) {
+	param := func(name, def string) (string, error) {
+		v, found, err := e.Param(name)
+		if err != nil || !found || v == nil {
+			return def, err
+		}
+		return fmt.Sprintf("%v", v), nil
+	}
+
+	row := report.Row{Values: map[string]interface{}{"env": e.Name}}
+	site, err := param("site", "")
+	if err != nil {
+		return row, err
+	}
+	row.Group = site
+
+	name, err := param("kit", "dev")
+	if err != nil {
+		return row, err
+	}
+	constraint, err := param("version", "latest")
+	if err != nil {
+		return row, err
+	}
+	row.Values["name"] = name
+	row.Values["constraint"] = constraint
+
+	resolved := constraint
+	if name != "dev" {
+		versions, err := kit.Versions(e.Root, name)
+		if err != nil {
+			return row, err
+		}
+		if len(versions) > 0 {
+			latest := versions[len(versions)-1]
+			if constraint == "latest" {
+				resolved = latest
+			}
+			if kit.CompareVersions(latest, resolved) > 0 {
+				row.Values["upgrade"] = latest
+			}
+		}
+		row.Values["kit"] = name + "/" + resolved
+	} else {
+		row.Values["kit"] = "dev"
+	}
+	row.Values["resolved"] = resolved
+
+	director, err := e.Director()
+	if err != nil {
+		return row, err
+	}
+	row.Values["director"] = director
+
+	prefix, err := e.VaultPrefix()
+	if err != nil {
+		return row, err
+	}
+	row.Values["vault"] = prefix
+
+	last, deployed, err := e.LastDeployed()
+	if err != nil {
+		return row, err
+	}
+	if deployed {
+		row.Values["last"] = last
+		row.Values["age"] = int(time.Since(last).Hours() / 24)
+	}
+	return row, nil
+}
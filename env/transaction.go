@@ -0,0 +1,129 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jhunt/genesis/vault"
+)
+
+// A transaction keeps track of everything `genesis new` does to the
+// outside world (secrets written to the Vault, files written to disk),
+// so that if a later step fails, it can all be undone.  Files are staged
+// next to their final destination, and only renamed into place on commit.
+type transaction struct {
+	vault     vault.Vault
+	secrets   []string
+	previous  [][]string // path, key and previous value of overwritten secrets
+	staged    [][]string
+	renamed   int // how many of the staged files are in place
+	committed bool
+}
+
+// RollbackError is returned when a transaction is rolled back, and
+// describes exactly what was (and what could not be) undone.
+type RollbackError struct {
+	Cause  error
+	Undone []string
+	Failed []string
+}
+
+func (e RollbackError) Error() string {
+	var b bytes.Buffer
+	b.WriteString(e.Cause.Error())
+	if len(e.Undone) > 0 {
+		b.WriteString("\n\nthe following changes were rolled back:\n")
+		for _, s := range e.Undone {
+			fmt.Fprintf(&b, "  - %s\n", s)
+		}
+	}
+	if len(e.Failed) > 0 {
+		b.WriteString("\nthe following changes could NOT be rolled back, and must be cleaned up by hand:\n")
+		for _, s := range e.Failed {
+			fmt.Fprintf(&b, "  - %s\n", s)
+		}
+	}
+	return b.String()
+}
+
+func newTransaction(v vault.Vault) *transaction {
+	return &transaction{vault: v}
+}
+
+// note secrets that did not exist before this transaction began
+func (t *transaction) created(paths ...string) {
+	t.secrets = append(t.secrets, paths...)
+}
+
+// note a secret that is about to be overwritten, and what it was
+func (t *transaction) overwriting(path, key, value string) {
+	t.previous = append(t.previous, []string{path, key, value})
+}
+
+func (t *transaction) stage(path string, b []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".new")
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	t.staged = append(t.staged, []string{tmp, path})
+	return nil
+}
+
+// Move the staged files into place.  If that fails part of the way, the
+// ones already in place are removed again by rollback.
+func (t *transaction) commit() error {
+	for _, f := range t.staged {
+		if _, err := os.Stat(f[1]); err == nil {
+			return fmt.Errorf("%s already exists; refusing to overwrite it", f[1])
+		}
+	}
+	for _, f := range t.staged {
+		if err := os.Rename(f[0], f[1]); err != nil {
+			return err
+		}
+		t.renamed++
+	}
+	t.committed = true
+	return nil
+}
+
+// Undo everything (in reverse order), unless the transaction has
+// already been committed; returns a RollbackError wrapping the cause
+// if there was anything to undo.
+func (t *transaction) rollback(cause error) error {
+	if t.committed || (len(t.secrets) == 0 && len(t.previous) == 0 && len(t.staged) == 0) {
+		return cause
+	}
+
+	e := RollbackError{Cause: cause}
+	for i := len(t.staged) - 1; i >= 0; i-- {
+		path := t.staged[i][0]
+		if i < t.renamed {
+			path = t.staged[i][1]
+		}
+		if err := os.Remove(path); err == nil {
+			e.Undone = append(e.Undone, "removed file "+path)
+		} else if !os.IsNotExist(err) {
+			e.Failed = append(e.Failed, fmt.Sprintf("file %s (%s)", path, err))
+		}
+	}
+	for i := len(t.previous) - 1; i >= 0; i-- {
+		path, key := t.previous[i][0], t.previous[i][1]
+		if err := t.vault.Set(path, key, t.previous[i][2]); err != nil {
+			e.Failed = append(e.Failed, fmt.Sprintf("secret %s:%s, overwritten (%s)", path, key, err))
+		} else {
+			e.Undone = append(e.Undone, fmt.Sprintf("restored secret %s:%s", path, key))
+		}
+	}
+	for i := len(t.secrets) - 1; i >= 0; i-- {
+		if err := t.vault.Delete(t.secrets[i]); err != nil {
+			e.Failed = append(e.Failed, fmt.Sprintf("secret %s (%s)", t.secrets[i], err))
+		} else {
+			e.Undone = append(e.Undone, "deleted secret "+t.secrets[i])
+		}
+	}
+	return e
+}
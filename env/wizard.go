@@ -0,0 +1,226 @@
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/genesis/kit"
+	"gopkg.in/yaml.v2"
+)
+
+// Answers to kit-declared params, keyed by param name.
+type Answers map[string]interface{}
+
+func LoadAnswers(path string) (Answers, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	// allow answers files that look like env files, i.e. params: { ... }
+	if params, ok := raw["params"].(map[interface{}]interface{}); ok && len(raw) == 1 {
+		raw = make(map[string]interface{})
+		for k, v := range params {
+			raw[fmt.Sprintf("%v", k)] = v
+		}
+	}
+	return Answers(raw), nil
+}
+
+// AnswersError lists everything that was wrong with the answers given
+// to a non-interactive `genesis new`, all at once.
+type AnswersError struct {
+	Missing []kit.Param
+	Invalid map[string]error
+}
+
+func (e AnswersError) Error() string {
+	var b bytes.Buffer
+	if len(e.Missing) > 0 {
+		fmt.Fprintf(&b, "no answer was given for the following required params:\n")
+		for _, p := range e.Missing {
+			fmt.Fprintf(&b, "  - %s", p.Name)
+			if p.Description != "" {
+				fmt.Fprintf(&b, "  (%s)", strings.TrimSpace(strings.Split(p.Description, "\n")[0]))
+			}
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+	if len(e.Invalid) > 0 {
+		fmt.Fprintf(&b, "the following answers are not valid:\n")
+		names := make([]string, 0, len(e.Invalid))
+		for name := range e.Invalid {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "  - %s: %s\n", name, e.Invalid[name])
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Pick up answers from GENESIS_PARAM_* environment variables; params.foo_bar
+// is answered by $GENESIS_PARAM_FOO_BAR.
+func EnvironmentAnswers(k kit.Kit, environ []string) Answers {
+	vars := make(map[string]string)
+	for _, kv := range environ {
+		if l := strings.SplitN(kv, "=", 2); len(l) == 2 {
+			vars[l[0]] = l[1]
+		}
+	}
+
+	answers := make(Answers)
+	for _, p := range k.Params {
+		if v, ok := vars[ParamVariable(p.Name)]; ok {
+			answers[p.Name] = v
+		}
+	}
+	return answers
+}
+
+func ParamVariable(name string) string {
+	return "GENESIS_PARAM_" + strings.ToUpper(regexp.MustCompile(`[^A-Za-z0-9]`).ReplaceAllString(name, "_"))
+}
+
+// Work out a value for every kit param that this environment doesn't
+// already inherit from its predecessor files, consulting the supplied
+// answers first, then prompting the operator (on in / out).  If yes is
+// set, nobody is prompted; defaults are used where the kit has them,
+// and anything else left unanswered is reported as an AnswersError.
+func (e Env) Ask(k kit.Kit, answers Answers, in io.Reader, out io.Writer, yes bool) (Answers, error) {
+	values := make(Answers)
+	r := bufio.NewReader(in)
+	problems := AnswersError{Invalid: make(map[string]error)}
+
+	for _, p := range k.Params {
+		source, err := e.Source("params." + p.Name)
+		if err != nil {
+			return nil, err
+		}
+		if source != "" {
+			fmt.Fprintf(out, "Using params.%s, inherited from %s\n", p.Name, source)
+			continue
+		}
+
+		if v, ok := answers[p.Name]; ok {
+			v, err := answer(p, v)
+			if err != nil {
+				problems.Invalid[p.Name] = err
+				continue
+			}
+			values[p.Name] = v
+			continue
+		}
+
+		if yes {
+			if p.Default != nil {
+				values[p.Name] = p.Default
+			} else if !p.Optional {
+				problems.Missing = append(problems.Missing, p)
+			}
+			continue
+		}
+
+		v, err := prompt(p, r, in, out)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			values[p.Name] = v
+		}
+	}
+
+	if len(problems.Missing) > 0 || len(problems.Invalid) > 0 {
+		return nil, problems
+	}
+	return values, nil
+}
+
+func answer(p kit.Param, v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok && p.Kind() != "string" {
+		return p.Parse(s)
+	}
+	return v, p.Check(v)
+}
+
+func prompt(p kit.Param, r *bufio.Reader, in io.Reader, out io.Writer) (interface{}, error) {
+	fmt.Fprintf(out, "\n")
+	if p.Description != "" {
+		fmt.Fprintf(out, "%s\n", strings.TrimSpace(p.Description))
+	}
+	if len(p.Choices) > 0 {
+		fmt.Fprintf(out, "(one of: %s)\n", strings.Join(p.Choices, ", "))
+	}
+	if p.Kind() == "list" {
+		fmt.Fprintf(out, "(separate multiple values with commas)\n")
+	}
+
+	for {
+		fmt.Fprintf(out, "%s", p.Name)
+		if p.Default != nil && !p.Secret {
+			fmt.Fprintf(out, " [%v]", p.Default)
+		}
+		fmt.Fprintf(out, "> ")
+
+		if p.Secret {
+			echo(in, false)
+		}
+		line, err := r.ReadString('\n')
+		if p.Secret {
+			echo(in, true)
+			fmt.Fprintf(out, "\n")
+		}
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("no answer given for params.%s", p.Name)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if p.Default != nil {
+				return p.Default, nil
+			}
+			if p.Optional {
+				return nil, nil
+			}
+			fmt.Fprintf(out, "params.%s is required.\n", p.Name)
+			continue
+		}
+
+		v, err := p.Parse(line)
+		if err != nil {
+			fmt.Fprintf(out, "%s\n", err)
+			continue
+		}
+		return v, nil
+	}
+}
+
+// turn terminal echo on / off, for reading secrets; a no-op if we
+// aren't reading from a terminal.
+func echo(in io.Reader, on bool) {
+	f, ok := in.(*os.File)
+	if !ok {
+		return
+	}
+	arg := "-echo"
+	if on {
+		arg = "echo"
+	}
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = f
+	cmd.Run()
+}
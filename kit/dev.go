@@ -2,19 +2,38 @@ package kit
 
 import (
 	"os"
+	"path/filepath"
 )
 
 func DevKit() (Kit, error) {
-	f, err := os.Open(DevDirectory+"/"+KitMetadataFile)
+	return DevKitIn(".")
+}
+
+// The development kit in the dev/ directory of the deployments repo at
+// root.  A dev/ without a kit.yml is a kit with no metadata (and so no
+// declarative subkits or params), not a missing one.
+func DevKitIn(root string) (Kit, error) {
+	dir, err := filepath.Abs(filepath.Join(root, DevDirectory))
 	if err != nil {
-		if os.IsNotExist(err) {
+		return Kit{}, err
+	}
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		if err == nil || os.IsNotExist(err) {
 			return Kit{}, NotFoundError{IsDev: true}
 		}
 		return Kit{}, err
 	}
+
+	k := Kit{IsDev: true, Path: dir}
+	f, err := os.Open(filepath.Join(dir, KitMetadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return k, nil
+		}
+		return Kit{}, err
+	}
 	defer f.Close()
 
-	k := Kit{IsDev: true}
 	err = k.load(f)
 	if err != nil {
 		return k, err
@@ -0,0 +1,137 @@
+package kit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A Hook is a well-known executable, shipped in the hooks/ directory
+// of a kit, that Genesis runs at specific points in an environment's
+// lifecycle.  Every hook is run from the root of the deployments repo,
+// with the following environment variables set:
+//
+//	GENESIS_ROOT                 Absolute path to the deployments repo
+//	GENESIS_ENVIRONMENT          Name of the environment (us-west-1-prod)
+//	GENESIS_VAULT_PREFIX         Vault path (under secret/) for credentials
+//	GENESIS_KIT_NAME             Name of the kit (or "dev")
+//	GENESIS_KIT_VERSION          Version of the kit (empty for dev kits)
+//	GENESIS_REQUESTED_FEATURES   Space-separated list of active subkits
+//
+// Hooks may use standard error freely, to talk to the operator.  What
+// they print to standard output is interpreted by Genesis, depending
+// on the hook (see below); non-zero exit codes abort the calling command.
+type Hook string
+
+const (
+	HooksDirectory = "hooks"
+
+	// Legacy prerequisite check, at the root of the kit; its output is
+	// passed through to the operator untouched.
+	PrereqsHook Hook = "prereqs"
+
+	// Run by `genesis new`; prints the YAML body of the new environment
+	// file, which replaces the default params: block Genesis would write.
+	NewHook Hook = "hooks/new"
+
+	// Run by `genesis manifest`; prints the kit-relative paths of the
+	// YAML files to merge (one per line), replacing base/ + subkits/.
+	BlueprintHook Hook = "hooks/blueprint"
+
+	// Run by `genesis new` and `genesis secrets` after the kit-declared
+	// credentials are generated, with a single argument: `add` (only
+	// create missing credentials) or `rotate`.  Output is passed through.
+	SecretsHook Hook = "hooks/secrets"
+
+	// Run by `genesis new` once the environment exists; prints free-form
+	// information about the environment, shown to the operator as-is.
+	InfoHook Hook = "hooks/info"
+
+	// Run by `genesis do ENV ADDON [ARGS...]`, with ADDON and ARGS as its
+	// arguments.  Standard input and output are connected to the operator.
+	AddonHook Hook = "hooks/addon"
+
+	// Run by `genesis manifest` before merging; prints nothing on success,
+	// and explains (on standard error) why the environment is not viable.
+	CheckHook Hook = "hooks/check"
+)
+
+type HookEnv struct {
+	Root        string
+	Environment string
+	VaultPrefix string
+	Features    []string
+}
+
+type HookError struct {
+	Hook Hook
+	Code int
+}
+
+func (e HookError) Error() string {
+	return fmt.Sprintf("kit %s hook failed (exited %d)", strings.TrimPrefix(string(e.Hook), HooksDirectory+"/"), e.Code)
+}
+
+func IsHookError(e error) bool {
+	_, ok := e.(HookError)
+	return ok
+}
+
+func (k Kit) HasHook(h Hook) bool {
+	st, err := os.Stat(filepath.Join(k.Root(), string(h)))
+	return err == nil && !st.IsDir() && st.Mode()&0111 != 0
+}
+
+func (k Kit) hookEnv(env HookEnv) []string {
+	name := k.Name
+	if k.IsDev {
+		name = "dev"
+	}
+	root, err := filepath.Abs(env.Root)
+	if err != nil {
+		root = env.Root
+	}
+	return append(os.Environ(),
+		"GENESIS_ROOT="+root,
+		"GENESIS_ENVIRONMENT="+env.Environment,
+		"GENESIS_VAULT_PREFIX="+env.VaultPrefix,
+		"GENESIS_KIT_NAME="+name,
+		"GENESIS_KIT_VERSION="+k.Version,
+		"GENESIS_REQUESTED_FEATURES="+strings.Join(env.Features, " "),
+	)
+}
+
+// Run a hook, feeding it stdin (if not nil) and capturing its standard
+// output, which is returned.  Standard error goes straight to ours.
+func (k Kit) RunHook(h Hook, env HookEnv, stdin io.Reader, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := k.ExecHook(h, env, stdin, &stdout, args...)
+	return stdout.String(), err
+}
+
+// Run a hook with caller-supplied standard input and output.
+func (k Kit) ExecHook(h Hook, env HookEnv, stdin io.Reader, stdout io.Writer, args ...string) error {
+	path, err := filepath.Abs(filepath.Join(k.Root(), string(h)))
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = env.Root
+	cmd.Env = k.hookEnv(env)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if x, ok := err.(*exec.ExitError); ok {
+			return HookError{Hook: h, Code: x.ExitCode()}
+		}
+		return err
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ type Kit struct {
 	Name    string
 	Version string
 	IsDev   bool
+	Path    string
 
 	Summary  string
 	Author   string
@@ -16,4 +17,7 @@ type Kit struct {
 	Github   string
 
 	Vault map[string]interface{}
+
+	SubkitGroups []SubkitGroup
+	Params       []Param
 }
@@ -14,6 +14,8 @@ func (k *Kit) load(in io.Reader) error {
 		Homepage string                 `yaml:"homepage"`
 		Github   string                 `yaml:"github"`
 		Vault    map[string]interface{} `yaml:"vault"`
+		Subkits  []SubkitGroup          `yaml:"subkits"`
+		Params   []Param                `yaml:"params"`
 	}{}
 
 	b, err := ioutil.ReadAll(in)
@@ -30,5 +32,8 @@ func (k *Kit) load(in io.Reader) error {
 	k.Author = meta.Author
 	k.Homepage = meta.Author
 	k.Github = meta.Github
+	k.Vault = meta.Vault
+	k.SubkitGroups = meta.Subkits
+	k.Params = meta.Params
 	return nil
 }
@@ -0,0 +1,45 @@
+package kit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	OpsDirectory     = "ops"
+	RuntimeDirectory = "runtime"
+)
+
+// the list of BOSH ops-files to apply to the merged manifest, for the
+// given subkits; base/ops/ files first, then each subkit's ops/ files
+func (k Kit) OpsFiles(subkits []string) ([]string, error) {
+	return k.nested(OpsDirectory, subkits)
+}
+
+// the list of runtime-config fragments to merge and upload alongside the
+// deployment, for the given subkits; base/runtime/ files first, then each
+// subkit's runtime/ files
+func (k Kit) RuntimeFiles(subkits []string) ([]string, error) {
+	return k.nested(RuntimeDirectory, subkits)
+}
+
+func (k Kit) nested(sub string, subkits []string) ([]string, error) {
+	files, err := yamls(filepath.Join(k.Root(), "base", sub))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range subkits {
+		dir := filepath.Join(k.Root(), SubkitsDirectory, s)
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("subkit '%s' not found in %s", s, k.Root())
+		}
+		l, err := yamls(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, l...)
+	}
+	return files, nil
+}
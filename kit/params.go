@@ -0,0 +1,120 @@
+package kit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Param is an environment parameter that the kit needs to know about,
+// declared in the `params:` section of kit.yml so that `genesis new`
+// can ask the operator for it:
+//
+//	params:
+//	  - name:        domain
+//	    description: What domain shall we use?
+//	    validate:    ^[a-z0-9.-]+$
+//
+//	  - name:        instances
+//	    description: How many web nodes do you need?
+//	    type:        integer
+//	    default:     2
+//
+//	  - name:        admin_password
+//	    description: Password for the administrative account
+//	    secret:      yes
+//
+// Secret params are stored in the Vault, not in the environment file.
+type Param struct {
+	Name        string      `yaml:"name"`
+	Description string      `yaml:"description"`
+	Type        string      `yaml:"type"`
+	Default     interface{} `yaml:"default"`
+	Validate    string      `yaml:"validate"`
+	Choices     []string    `yaml:"choices"`
+	Secret      bool        `yaml:"secret"`
+	Optional    bool        `yaml:"optional"`
+}
+
+func (p Param) Kind() string {
+	if p.Type == "" {
+		return "string"
+	}
+	return p.Type
+}
+
+// Parse (and validate) an answer given as a string, i.e. from a prompt
+// or an environment variable, into a value of the appropriate type.
+func (p Param) Parse(s string) (interface{}, error) {
+	var v interface{}
+	switch p.Kind() {
+	case "string":
+		v = s
+
+	case "integer":
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a whole number", s)
+		}
+		v = i
+
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "y", "yes", "true", "on":
+			v = true
+		case "n", "no", "false", "off":
+			v = false
+		default:
+			return nil, fmt.Errorf("'%s' is not a yes / no answer", s)
+		}
+
+	case "list":
+		l := make([]interface{}, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				l = append(l, item)
+			}
+		}
+		v = l
+
+	default:
+		return nil, fmt.Errorf("params.%s has an unrecognized type '%s'", p.Name, p.Type)
+	}
+
+	return v, p.Check(v)
+}
+
+// Check that a (typed) value is acceptable for this param.
+func (p Param) Check(v interface{}) error {
+	values := []interface{}{v}
+	if l, ok := v.([]interface{}); ok {
+		values = l
+	}
+
+	for _, v := range values {
+		s := fmt.Sprintf("%v", v)
+		if len(p.Choices) > 0 {
+			ok := false
+			for _, c := range p.Choices {
+				if c == s {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return fmt.Errorf("'%s' is not one of: %s", s, strings.Join(p.Choices, ", "))
+			}
+		}
+		if p.Validate != "" {
+			re, err := regexp.Compile(p.Validate)
+			if err != nil {
+				return fmt.Errorf("params.%s has an invalid validation pattern /%s/: %s", p.Name, p.Validate, err)
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("'%s' does not match /%s/", s, p.Validate)
+			}
+		}
+	}
+	return nil
+}
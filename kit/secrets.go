@@ -0,0 +1,117 @@
+package kit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Secret is a single credential that the kit wants generated in the
+// Vault, as declared in the `vault:` section of kit.yml:
+//
+//	vault:
+//	  random:
+//	    password: random 42
+//	  ssh: ssh 4096
+//	  rsa: rsa 4096 fixed
+//
+// Fixed credentials are generated once, and never rotated.
+type Secret struct {
+	Path  string
+	Key   string
+	Type  string
+	Size  int
+	Fixed bool
+}
+
+func (s Secret) String() string {
+	if s.Key != "" {
+		return s.Path + ":" + s.Key
+	}
+	return s.Path
+}
+
+func (k Kit) Secrets() ([]Secret, error) {
+	l := make([]Secret, 0)
+
+	paths := make([]string, 0, len(k.Vault))
+	for path := range k.Vault {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		switch v := k.Vault[path].(type) {
+		case string:
+			s, err := parseSecret(path, "", v)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, s)
+
+		case map[interface{}]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, fmt.Sprintf("%v", key))
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				spec, ok := v[key].(string)
+				if !ok {
+					return nil, fmt.Errorf("vault.%s.%s: credential specification must be a string", path, key)
+				}
+				s, err := parseSecret(path, key, spec)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, s)
+			}
+
+		default:
+			return nil, fmt.Errorf("vault.%s: credential specification must be a string or a map", path)
+		}
+	}
+	return l, nil
+}
+
+func parseSecret(path, key, spec string) (Secret, error) {
+	where := "vault." + path
+	if key != "" {
+		where += "." + key
+	}
+
+	f := strings.Fields(spec)
+	if len(f) == 3 && f[2] == "fixed" {
+		f = f[:2]
+	} else if len(f) != 2 {
+		return Secret{}, fmt.Errorf("%s: '%s' does not look like a valid credential specification", where, spec)
+	}
+
+	size, err := strconv.Atoi(f[1])
+	if err != nil || size <= 0 {
+		return Secret{}, fmt.Errorf("%s: '%s' is not a valid size", where, f[1])
+	}
+
+	s := Secret{
+		Path:  path,
+		Key:   key,
+		Type:  f[0],
+		Size:  size,
+		Fixed: len(strings.Fields(spec)) == 3,
+	}
+	switch s.Type {
+	case "random":
+		if key == "" {
+			return s, fmt.Errorf("%s: random credentials must be given a key (i.e. %s: { password: %s })", where, path, spec)
+		}
+	case "ssh", "rsa":
+		if key != "" {
+			return s, fmt.Errorf("%s: %s keypairs cannot be stored under a specific key", where, s.Type)
+		}
+	default:
+		return s, fmt.Errorf("%s: unrecognized credential type '%s'", where, s.Type)
+	}
+	return s, nil
+}
@@ -0,0 +1,286 @@
+package kit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SubkitsDirectory = "subkits"
+	IdentifyHook     = "subkits/identify"
+
+	// exit codes used by identify scripts (and by us)
+	SubkitMissing = 66
+	SubkitInvalid = 67
+)
+
+// A SubkitGroup is a declarative subkit selection, read from the
+// `subkits:` section of kit.yml.  Each group consults a single
+// environment parameter, and picks one (or, if Multiple is set,
+// several) of its Choices based on the value found there:
+//
+//	subkits:
+//	  - name:  blobstore
+//	    param: blobstore_type
+//	    description: |
+//	      I need to know what blobstore type you wish to use
+//	      for this deployment.
+//	    choices:
+//	      - value: s3
+//	        description: an Amazon-backed blobstore solution
+//	      - value: webdav
+//	        description: a locally-hosted HTTP/DAV solution
+type SubkitGroup struct {
+	Name        string         `yaml:"name"`
+	Param       string         `yaml:"param"`
+	Description string         `yaml:"description"`
+	Default     interface{}    `yaml:"default"`
+	Optional    bool           `yaml:"optional"`
+	Multiple    bool           `yaml:"multiple"`
+	Choices     []SubkitChoice `yaml:"choices"`
+}
+
+type SubkitChoice struct {
+	Value       string   `yaml:"value"`
+	Subkit      string   `yaml:"subkit"`
+	Description string   `yaml:"description"`
+	Requires    []string `yaml:"requires"`
+	Conflicts   []string `yaml:"conflicts"`
+}
+
+// the name of the subkits/ directory this choice activates
+func (c SubkitChoice) Name() string {
+	if c.Subkit != "" {
+		return c.Subkit
+	}
+	return c.Value
+}
+
+type SubkitError struct {
+	Code    int
+	Message string
+}
+
+func (e SubkitError) Error() string {
+	return e.Message
+}
+
+func IsSubkitError(e error) bool {
+	_, ok := e.(SubkitError)
+	return ok
+}
+
+// a function that can look up an environment parameter (without the
+// leading `params.`), across the entire environment hierarchy
+type ParamLookup func(name string) (interface{}, bool, error)
+
+func (k Kit) Root() string {
+	if k.Path != "" {
+		return k.Path
+	}
+	return DevDirectory
+}
+
+// Determine which subkits should be activated for the named environment.
+// Declarative `subkits:` groups from kit.yml take precedence; kits that
+// do not declare any fall back to running their subkits/identify hook.
+func (k Kit) Subkits(envname string, param ParamLookup) ([]string, error) {
+	if len(k.SubkitGroups) == 0 {
+		return k.identify(envname)
+	}
+
+	selected := make([]string, 0)
+	why := make(map[string]string)
+	for _, g := range k.SubkitGroups {
+		l, err := g.resolve(envname, param)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range l {
+			selected = append(selected, c.Name())
+			why[c.Name()] = fmt.Sprintf("params.%s = %s", g.Param, c.Value)
+		}
+	}
+
+	for _, g := range k.SubkitGroups {
+		for _, c := range g.Choices {
+			if _, ok := why[c.Name()]; !ok {
+				continue
+			}
+			for _, other := range c.Requires {
+				if _, ok := why[other]; !ok {
+					return nil, SubkitError{
+						Code: SubkitInvalid,
+						Message: fmt.Sprintf("The '%s' subkit (activated by %s) requires the '%s' subkit,\n"+
+							"but nothing in %s (or its predecessor files) activates it.\n",
+							c.Name(), why[c.Name()], other, envname),
+					}
+				}
+			}
+			for _, other := range c.Conflicts {
+				if _, ok := why[other]; ok {
+					return nil, SubkitError{
+						Code: SubkitInvalid,
+						Message: fmt.Sprintf("The '%s' subkit (activated by %s) cannot be used\n"+
+							"together with the '%s' subkit (activated by %s).\n",
+							c.Name(), why[c.Name()], other, why[other]),
+					}
+				}
+			}
+		}
+	}
+
+	return selected, nil
+}
+
+func (g SubkitGroup) resolve(envname string, param ParamLookup) ([]SubkitChoice, error) {
+	v, found, err := param(g.Param)
+	if err != nil {
+		return nil, err
+	}
+	if !found || v == nil {
+		v = g.Default
+	}
+	if v == nil {
+		if g.Optional {
+			return nil, nil
+		}
+		return nil, SubkitError{
+			Code: SubkitMissing,
+			Message: fmt.Sprintf("I could not find params.%s in %s\n(or in any of its predecessor files).\n\n%s",
+				g.Param, envname, g.help()),
+		}
+	}
+
+	values := []interface{}{v}
+	if l, ok := v.([]interface{}); ok {
+		if !g.Multiple {
+			return nil, SubkitError{
+				Code: SubkitInvalid,
+				Message: fmt.Sprintf("params.%s must be a single value, not a list.\n\n%s",
+					g.Param, g.help()),
+			}
+		}
+		values = l
+	}
+
+	chosen := make([]SubkitChoice, 0)
+	for _, v := range values {
+		s := fmt.Sprintf("%v", v)
+		c, ok := g.choice(s)
+		if !ok {
+			return nil, SubkitError{
+				Code: SubkitInvalid,
+				Message: fmt.Sprintf("'%s' does not look like a valid %s.\n\n%s",
+					s, g.Param, g.help()),
+			}
+		}
+		chosen = append(chosen, c)
+	}
+	return chosen, nil
+}
+
+func (g SubkitGroup) choice(value string) (SubkitChoice, bool) {
+	for _, c := range g.Choices {
+		if c.Value == value {
+			return c, true
+		}
+	}
+	return SubkitChoice{}, false
+}
+
+// the explanation appended to every error message for this group,
+// generated from the group (and choice) descriptions
+func (g SubkitGroup) help() string {
+	var b bytes.Buffer
+	if g.Description != "" {
+		b.WriteString(strings.TrimSuffix(g.Description, "\n") + "\n")
+	} else {
+		name := g.Name
+		if name == "" {
+			name = g.Param
+		}
+		fmt.Fprintf(&b, "I need to know which %s you wish to use for this deployment.\n", name)
+	}
+
+	if g.Multiple {
+		fmt.Fprintf(&b, "Valid values (one or more, as a list) are:\n\n")
+	} else {
+		fmt.Fprintf(&b, "Valid values are:\n\n")
+	}
+	n := 0
+	for _, c := range g.Choices {
+		if len(c.Value) > n {
+			n = len(c.Value)
+		}
+	}
+	for _, c := range g.Choices {
+		b.WriteString(strings.TrimRight(fmt.Sprintf("  %-*s  %s", n, c.Value, c.Description), " ") + "\n")
+	}
+	return b.String()
+}
+
+// run the legacy subkits/identify hook, which prints the names of the
+// subkits to activate (one per line) and signals errors by exiting 66
+// (missing parameters) or 67 (invalid parameters)
+func (k Kit) identify(envname string) ([]string, error) {
+	path := filepath.Join(k.Root(), IdentifyHook)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, envname)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if x, ok := err.(*exec.ExitError); ok {
+			return nil, SubkitError{
+				Code:    x.ExitCode(),
+				Message: stderr.String(),
+			}
+		}
+		return nil, err
+	}
+
+	l := make([]string, 0)
+	for _, s := range strings.Split(stdout.String(), "\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			l = append(l, s)
+		}
+	}
+	return l, nil
+}
+
+// the list of kit YAML files to merge for the given subkits; base/
+// files first, followed by each subkit's files, in order
+func (k Kit) Files(subkits []string) ([]string, error) {
+	files, err := yamls(filepath.Join(k.Root(), "base"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range subkits {
+		dir := filepath.Join(k.Root(), SubkitsDirectory, s)
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("subkit '%s' not found in %s", s, k.Root())
+		}
+		l, err := yamls(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, l...)
+	}
+	return files, nil
+}
+
+func yamls(dir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dir, "*.yml"))
+}
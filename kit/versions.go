@@ -0,0 +1,77 @@
+package kit
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const CompiledKitsDirectory = ".genesis/kits"
+
+// Versions of the named kit that are available (as compiled tarballs)
+// in the deployments repo at root, from oldest to newest.
+func Versions(root, name string) ([]string, error) {
+	l, err := filepath.Glob(filepath.Join(root, CompiledKitsDirectory, name+"-*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, 0, len(l))
+	for _, path := range l {
+		v := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), name+"-"), ".tar.gz")
+		if v != "" && v[0] >= '0' && v[0] <= '9' {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
+
+// Compare two dotted version strings, numerically, component by
+// component; pre-release suffixes (1.2.3-rc.1) sort before the release.
+func CompareVersions(a, b string) int {
+	va, pa := splitVersion(a)
+	vb, pb := splitVersion(b)
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	case pa < pb:
+		return -1
+	}
+	return 1
+}
+
+func splitVersion(s string) ([]int, string) {
+	pre := ""
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, pre = s[:i], s[i+1:]
+	}
+	l := make([]int, 0)
+	for _, part := range strings.Split(s, ".") {
+		n, _ := strconv.Atoi(part)
+		l = append(l, n)
+	}
+	return l, pre
+}
@@ -5,11 +5,20 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/jhunt/genesis/bosh"
 	. "github.com/jhunt/genesis/command"
+	"github.com/jhunt/genesis/diff"
+	"github.com/jhunt/genesis/env"
+	"github.com/jhunt/genesis/kit"
+	"github.com/jhunt/genesis/pipeline"
+	"github.com/jhunt/genesis/policy"
+	"github.com/jhunt/genesis/vault"
 	"github.com/pborman/getopt"
 	fmt "github.com/starkandwayne/goutils/ansi"
+	"gopkg.in/yaml.v2"
 )
 
 func require(good bool, msg string) {
@@ -30,6 +39,28 @@ var (
 
 var Version = ""
 
+// the kit that new environments should use: dev/, if there is one,
+// or the latest compiled kit in .genesis/kits
+func currentKit() (kit.Kit, error) {
+	k, err := kit.DevKit()
+	if err == nil || !kit.IsNotFound(err) {
+		return k, err
+	}
+	return kit.LatestKit()
+}
+
+// the deployments repo that a pipeline task's genesis lives in (i.e. code/,
+// for code/bin/genesis), unless we were told otherwise, via --cwd
+func pipelineRoot(opts Options) string {
+	if *opts.Cwd == "." && strings.Contains(os.Args[0], "/") {
+		root := filepath.Dir(filepath.Dir(os.Args[0]))
+		if _, err := os.Stat(filepath.Join(root, ".git")); err == nil {
+			return root
+		}
+	}
+	return *opts.Cwd
+}
+
 func main() {
 	options := Options{
 		Cwd:     getopt.StringLong("cwd", 'C', ".", "Effective working directory. Defaults to '.'"),
@@ -70,11 +101,18 @@ func main() {
 				fmt.Fprintf(os.Stderr, "    -C, --cwd        Effective working directory.  Defaults to '.'\n")
 				fmt.Fprintf(os.Stderr, "    -y, --yes        Answer 'yes' to all questions, automatically.\n")
 				fmt.Fprintf(os.Stderr, "\n\n  COMMANDS\n")
+				fmt.Fprintf(os.Stderr, "    check            Check an environment against the repo's policy rules.\n")
+				fmt.Fprintf(os.Stderr, "    compare          Show the differences between two environments.\n")
 				fmt.Fprintf(os.Stderr, "    compile-kit      Create a distributable kit archive from dev.\n")
 				fmt.Fprintf(os.Stderr, "    decompile-kit    Unpack a kit archive to dev.\n")
+				fmt.Fprintf(os.Stderr, "    deploy           Deploy an environment to its BOSH director.\n")
 				fmt.Fprintf(os.Stderr, "    describe         Describe a Concourse pipeline, in words.\n")
+				fmt.Fprintf(os.Stderr, "    diff             Show what a deploy would change.\n")
+				fmt.Fprintf(os.Stderr, "    do               Run a kit-provided addon against an environment.\n")
 				fmt.Fprintf(os.Stderr, "    download         Download a Genesis Kit from the Internet.\n")
 				fmt.Fprintf(os.Stderr, "    graph            Draw a Concourse pipeline.\n")
+				fmt.Fprintf(os.Stderr, "    history          Show the deployment history of an environment.\n")
+				fmt.Fprintf(os.Stderr, "    ips              Show the static IPs allocated to environments.\n")
 				fmt.Fprintf(os.Stderr, "    init             Initialize a new Genesis deployment.\n")
 				fmt.Fprintf(os.Stderr, "    lookup           Find a key set in environment manifests.\n")
 				fmt.Fprintf(os.Stderr, "    manifest         Generate a redacted BOSH deployment manifest for an environment.\n")
@@ -95,6 +133,303 @@ func main() {
 		})
 	c.Alias("usage", "help")
 
+	/* genesis affected */
+	c.Dispatch("affected", "Show which environments a change affects.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis affected [OPTIONS] [rev-range]\n\n")
+				fmt.Printf("Works out which environments are affected by the files changed over\n")
+				fmt.Printf("a range of commits (anything `git diff' understands, i.e. HEAD~1 or\n")
+				fmt.Printf("origin/master..HEAD), or by the changes that haven't been committed\n")
+				fmt.Printf("yet, if no range is given.  Environments are affected:\n\n")
+				fmt.Printf("  directly     by changes to their YAML files (including the ones\n")
+				fmt.Printf("               they inherit from, like client-aws.yml), or their kit\n")
+				fmt.Printf("               (dev/, or a tarball in .genesis/kits).\n")
+				fmt.Printf("  pipeline     by changes to the pipeline configuration, or to the\n")
+				fmt.Printf("               files propagated to them (in .genesis/cached).\n")
+				fmt.Printf("  downstream   by following an affected environment in the pipeline.\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -c, --config     Path to the pipeline configuration file.  Defaults to\n")
+				fmt.Printf("                   'ci.yml'; without one, the pipeline isn't considered.\n\n")
+				fmt.Printf("      --layout     Which of its pipeline layouts to use.  Defaults to\n")
+				fmt.Printf("                   'default'.\n\n")
+				fmt.Printf("  -f, --format     How to format the report; one of 'table' (the default),\n")
+				fmt.Printf("                   'json' or 'csv'.\n\n")
+				fmt.Printf("      --columns    A comma-separated list of columns to report on.  Defaults\n")
+				fmt.Printf("                   to 'env,how,because'; '--columns env -f csv' is handy for\n")
+				fmt.Printf("                   scripting.\n")
+				return nil
+			}
+
+			getopt.Reset()
+			config := getopt.StringLong("config", 'c', pipeline.DefaultConfig, "Path to the pipeline configuration file")
+			layout := getopt.StringLong("layout", 0, pipeline.DefaultLayout, "Which pipeline layout to use")
+			format := getopt.StringLong("format", 'f', "table", "How to format the report")
+			columns := getopt.StringLong("columns", 0, strings.Join(env.DefaultAffectedColumns, ","), "Columns to report on")
+
+			options := getopt.CommandLine
+			args = append([]string{"affected"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis affected [--config ci.yml] [--layout NAME] [--format FORMAT] [rev-range]}\n")
+				os.Exit(3)
+			}
+			revs := ""
+			if len(args) == 1 {
+				revs = args[0]
+			}
+
+			files, err := env.Changed(*opts.Cwd, revs)
+			if err != nil {
+				return err
+			}
+			impacts, err := env.Affected(*opts.Cwd, files)
+			if err != nil {
+				return err
+			}
+
+			// the pipeline is optional, unless asked for by name
+			if _, err := os.Stat(*config); err == nil || *config != pipeline.DefaultConfig {
+				c, err := pipeline.ReadConfig(*config)
+				if err != nil {
+					return err
+				}
+				l, err := c.ParseLayout(*layout)
+				if err != nil {
+					return err
+				}
+				impacts = l.Affected(*config, files, impacts)
+			}
+
+			r, err := env.AffectedReport(impacts, strings.Split(*columns, ","))
+			if err != nil {
+				return err
+			}
+			return r.Render(*format, os.Stdout)
+		})
+
+	/* genesis check */
+	c.Dispatch("check", "Check an environment against the repo's policy rules.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis check [--cloud-config path.yml] deployment-env.yml\n\n")
+				fmt.Printf("Checks the environment's (redacted) manifest against the\n")
+				fmt.Printf("policy rules in policy.yml, at the top of the repo, i.e.:\n\n")
+				fmt.Printf("    rules:\n")
+				fmt.Printf("      - id:          PROD-001\n")
+				fmt.Printf("        description: Production jobs need more than one instance\n")
+				fmt.Printf("        envs:        ['*-prod']\n")
+				fmt.Printf("        path:        instance_groups.*.instances\n")
+				fmt.Printf("        min:         2\n\n")
+				fmt.Printf("Rules check values at a `path' (with wildcards), or every value\n")
+				fmt.Printf("under map keys that match a `key' glob, against any of `min',\n")
+				fmt.Printf("`max', `in', `not_in' (lists) and `pattern' (a regex).  Rules\n")
+				fmt.Printf("that set `required: true' also demand that the path exists.\n")
+				fmt.Printf("Rules with `severity: warning' don't stop `genesis deploy'.\n\n")
+				fmt.Printf("Exits 1 if any (non-warning) rules are violated.\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config.\n")
+				return nil
+			}
+
+			getopt.Reset()
+			cloud := getopt.StringLong("cloud-config", 'c', "", "Path to your downloaded BOSH cloud-config")
+
+			options := getopt.CommandLine
+			args = append([]string{"check"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis check [--cloud-config path.yml] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			k, err := e.Kit()
+			if err != nil {
+				return err
+			}
+			if *cloud == "" {
+				*cloud, _ = e.CloudConfig(false)
+			}
+
+			violations, err := e.CheckPolicy(k, *cloud)
+			if err != nil {
+				return err
+			}
+			if len(violations) == 0 {
+				fmt.Printf("@G{No policy violations.}\n")
+				return nil
+			}
+
+			last := ""
+			for _, v := range violations {
+				if v.Rule.ID != last {
+					if last != "" {
+						fmt.Printf("\n")
+					}
+					last = v.Rule.ID
+					if v.Rule.Severity == policy.Warning {
+						fmt.Printf("@Y{%s}  %s (warning)\n", v.Rule.ID, v.Rule.Description)
+					} else {
+						fmt.Printf("@R{%s}  %s\n", v.Rule.ID, v.Rule.Description)
+					}
+				}
+				fmt.Printf("  - @C{%s}: %s\n", v.Path, v.Problem)
+			}
+			if len(policy.Errors(violations)) > 0 {
+				os.Exit(1)
+			}
+			return nil
+		})
+
+	/* genesis ci pipeline stage1 */
+	c.Dispatch("ci pipeline stage1", "Deploy an environment, from inside a Concourse pipeline.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis ci pipeline stage1\n\n")
+				fmt.Printf("Run by the tasks of pipelines from `genesis repipe', to deploy\n")
+				fmt.Printf("$CURRENT_ENV from a clone of the deployments repo (the one this\n")
+				fmt.Printf("genesis lives in) in $WORKING_DIR, recording the outcome in its\n")
+				fmt.Printf("deployment ledger.  On success, goes on to stage2.\n\n")
+				fmt.Printf("BOSH is configured by $BOSH_CONFIG (YAML, not a path) and\n")
+				fmt.Printf("$BOSH_TARGET; $VAULT_* are passed through to safe and spruce.\n")
+				fmt.Printf("If $DEPLOY_WINDOW is set (i.e. `weekdays 02:00-05:00'), nothing\n")
+				fmt.Printf("is deployed outside of that window.\n")
+				return nil
+			}
+			if len(args) != 0 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis ci pipeline stage1}\n")
+				os.Exit(3)
+			}
+
+			s, err := pipeline.StageFromEnvironment()
+			if err != nil {
+				return err
+			}
+			return s.Stage1(pipelineRoot(opts))
+		})
+
+	/* genesis ci pipeline stage2 */
+	c.Dispatch("ci pipeline stage2", "Propagate a deployed environment, from inside a Concourse pipeline.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis ci pipeline stage2\n\n")
+				fmt.Printf("Copies the YAML files that $CURRENT_ENV shares with other\n")
+				fmt.Printf("environments into .genesis/cached/$CURRENT_ENV/, where the\n")
+				fmt.Printf("environments downstream of it in the pipeline are watching,\n")
+				fmt.Printf("and commits them (with its ledger) in $WORKING_DIR, rebased\n")
+				fmt.Printf("onto $GIT_BRANCH, for the pipeline to push.\n")
+				return nil
+			}
+			if len(args) != 0 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis ci pipeline stage2}\n")
+				os.Exit(3)
+			}
+
+			s, err := pipeline.StageFromEnvironment()
+			if err != nil {
+				return err
+			}
+			return s.Stage2(pipelineRoot(opts))
+		})
+
+	/* genesis ci pipeline run-smoke-test */
+	c.Dispatch("ci pipeline run-smoke-test", "Smoke test an environment, from inside a Concourse pipeline.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis ci pipeline run-smoke-test\n\n")
+				fmt.Printf("Runs the $ERRAND_NAME errand against the deployment of\n")
+				fmt.Printf("$CURRENT_ENV, on $BOSH_TARGET (per $BOSH_CONFIG).\n")
+				return nil
+			}
+			if len(args) != 0 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis ci pipeline run-smoke-test}\n")
+				os.Exit(3)
+			}
+
+			s, err := pipeline.StageFromEnvironment()
+			if err != nil {
+				return err
+			}
+			return s.SmokeTest(pipelineRoot(opts))
+		})
+
+	/* genesis compare */
+	c.Dispatch("compare", "Show the differences between two environments.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis compare [OPTIONS] env-a.yml env-b.yml\n\n")
+				fmt.Printf("Compares the (redacted) manifests of two environments.\n")
+				fmt.Printf("Exits 0 if there are no differences, 1 if there are, and\n")
+				fmt.Printf("2 if something went wrong.\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config.\n\n")
+				fmt.Printf("  -p, --params               Only compare the environments' params.\n\n")
+				fmt.Printf("  -i, --ignore PATH          Ignore differences at (or under) PATH, i.e.\n")
+				fmt.Printf("                             `name' or `jobs.*.properties.domain'.\n")
+				fmt.Printf("                             Can be given more than once.\n")
+				return nil
+			}
+
+			getopt.Reset()
+			cloud := getopt.StringLong("cloud-config", 'c', "", "Path to your downloaded BOSH cloud-config")
+			params := getopt.BoolLong("params", 'p', "Only compare params")
+			ignore := getopt.ListLong("ignore", 'i', "Paths to ignore")
+
+			options := getopt.CommandLine
+			args = append([]string{"compare"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 2 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis compare [OPTIONS] env-a.yml env-b.yml}\n")
+				os.Exit(3)
+			}
+
+			changes, err := func() ([]diff.Change, error) {
+				a, err := env.Load(*opts.Cwd, args[0])
+				if err != nil {
+					return nil, err
+				}
+				b, err := env.Load(*opts.Cwd, args[1])
+				if err != nil {
+					return nil, err
+				}
+				return env.Compare(a, b, env.CompareOptions{
+					CloudConfig: *cloud,
+					ParamsOnly:  *params,
+					Ignore:      *ignore,
+				})
+			}()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "@R{!!! %s}\n", err)
+				os.Exit(2)
+			}
+
+			if len(changes) == 0 {
+				fmt.Printf("@G{No differences.}\n")
+				return nil
+			}
+			fmt.Printf("@R{--- %s}\n", args[0])
+			fmt.Printf("@G{+++ %s}\n\n", args[1])
+			diff.Print(os.Stdout, changes)
+			os.Exit(1)
+			return nil
+		})
+
 	/* genesis compile-kit */
 	// FIXME: implement
 	c.Dispatch("compile-kit", "Create a distributable kit archive from dev.",
@@ -128,8 +463,70 @@ func main() {
 			return nil
 		})
 
+	/* genesis deploy */
+	c.Dispatch("deploy", "Deploy an environment to its BOSH director.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis deploy [OPTIONS] deployment-env.yml\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config.\n")
+				fmt.Printf("                             By default, it is fetched from the director.\n\n")
+				fmt.Printf("      --vault TARGET         The name of a `safe' target (a Vault) where\n")
+				fmt.Printf("                             the environment's credentials are kept.\n\n")
+				fmt.Printf("  -y, --yes                  Don't ask for confirmation before deploying\n")
+				fmt.Printf("                             (`bosh deploy` still shows what's changing).\n\n")
+				fmt.Printf("  -n, --dry-run              Passed through to `bosh deploy`, along with\n")
+				fmt.Printf("      --recreate             any of these other options.\n")
+				fmt.Printf("      --fix\n")
+				fmt.Printf("      --skip-drain\n")
+				return nil
+			}
+
+			getopt.Reset()
+			cloud := getopt.StringLong("cloud-config", 'c', "", "Path to your downloaded BOSH cloud-config")
+			target := getopt.StringLong("vault", 0, "", "The name of a `safe' target (a Vault)")
+			dryrun := getopt.BoolLong("dry-run", 'n', "Don't actually deploy anything")
+			recreate := getopt.BoolLong("recreate", 0, "Recreate all VMs")
+			fix := getopt.BoolLong("fix", 0, "Recreate unresponsive instances")
+			skipdrain := getopt.BoolLong("skip-drain", 0, "Skip running drain scripts")
+			yes := getopt.BoolLong("yes", 'y', "Don't ask for confirmation")
+
+			options := getopt.CommandLine
+			args = append([]string{"deploy"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis deploy [OPTIONS] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			checkPrerequisites()
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			k, err := e.Kit()
+			if err != nil {
+				return err
+			}
+
+			return e.Deploy(k, env.DeployOptions{
+				DeployOptions: bosh.DeployOptions{
+					DryRun:    *dryrun,
+					Recreate:  *recreate,
+					Fix:       *fix,
+					SkipDrain: *skipdrain,
+				},
+				CloudConfig: *cloud,
+				Vault:       vault.Vault{Target: *target},
+				Interactive: !*opts.Yes && !*yes,
+			})
+		})
+
 	/* genesis describe */
-	// FIXME: implement
 	c.Dispatch("describe", "Describe a Concourse pipeline with words.",
 		func(opts Options, args []string, help bool) error {
 			if help {
@@ -142,10 +539,138 @@ func main() {
 				return nil
 			}
 
-			fmt.Printf("This is genesis describe.")
+			getopt.Reset()
+			config := getopt.StringLong("config", 'c', pipeline.DefaultConfig, "Path to the pipeline configuration file")
+
+			options := getopt.CommandLine
+			args = append([]string{"describe"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis describe [--config ci.yml] [pipeline-layout]}\n")
+				os.Exit(3)
+			}
+			name := pipeline.DefaultLayout
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			c, err := pipeline.ReadConfig(*config)
+			if err != nil {
+				return err
+			}
+			l, err := c.ParseLayout(name)
+			if err != nil {
+				return err
+			}
+			os.Stdout.WriteString(c.Describe(l))
+			return nil
+		})
+
+	/* genesis diff */
+	c.Dispatch("diff", "Show what a deploy would change.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis diff [OPTIONS] deployment-env.yml\n\n")
+				fmt.Printf("Compares the manifest that is currently deployed against\n")
+				fmt.Printf("what would be deployed now, with all credentials redacted.\n")
+				fmt.Printf("Exits 0 if there are no changes, 1 if there are, and 2 if\n")
+				fmt.Printf("something went wrong.\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config.\n")
+				fmt.Printf("                             By default, it is fetched from the director.\n\n")
+				fmt.Printf("      --cached               Compare against the manifest cached by the\n")
+				fmt.Printf("                             last successful `genesis deploy`, instead of\n")
+				fmt.Printf("                             asking the BOSH director (i.e. offline).\n")
+				return nil
+			}
+
+			getopt.Reset()
+			cloud := getopt.StringLong("cloud-config", 'c', "", "Path to your downloaded BOSH cloud-config")
+			cached := getopt.BoolLong("cached", 0, "Compare against the cached manifest")
+
+			options := getopt.CommandLine
+			args = append([]string{"diff"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis diff [OPTIONS] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			changes, err := func() ([]diff.Change, error) {
+				e, err := env.Load(*opts.Cwd, args[0])
+				if err != nil {
+					return nil, err
+				}
+				k, err := e.Kit()
+				if err != nil {
+					return nil, err
+				}
+				return e.Diff(k, env.DiffOptions{
+					CloudConfig: *cloud,
+					Cached:      *cached,
+				})
+			}()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "@R{!!! %s}\n", err)
+				os.Exit(2)
+			}
+
+			if len(changes) == 0 {
+				fmt.Printf("@G{No changes.}\n")
+				return nil
+			}
+			diff.Print(os.Stdout, changes)
+			os.Exit(1)
 			return nil
 		})
 
+	/* genesis do */
+	c.Dispatch("do", "Run a kit-provided addon against an environment.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis do deployment-env.yml ADDON [ARGUMENTS...]\n\n")
+				fmt.Printf("OPTIONS\n")
+				return nil
+			}
+
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis do deployment-env.yml ADDON [ARGUMENTS...]}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			k, err := e.Kit()
+			if err != nil {
+				return err
+			}
+			if !k.HasHook(kit.AddonHook) {
+				return fmt.Errorf("this kit does not provide any addons")
+			}
+			features, err := k.Subkits(e.Name, e.Param)
+			if err != nil {
+				return err
+			}
+			hookenv, err := e.HookEnv(features)
+			if err != nil {
+				return err
+			}
+
+			err = k.ExecHook(kit.AddonHook, hookenv, os.Stdin, os.Stdout, args[1:]...)
+			if x, ok := err.(kit.HookError); ok {
+				os.Exit(x.Code)
+			}
+			return err
+		})
+
 	/* genesis download */
 	// FIXME: implement
 	c.Dispatch("download", "Download a Genesis Kit from the Internet.",
@@ -162,23 +687,143 @@ func main() {
 		})
 
 	/* genesis graph */
-	// FIXME: implement
 	c.Dispatch("graph", "Draw a Concourse pipeline.",
 		func(opts Options, args []string, help bool) error {
 			if help {
 				fmt.Printf("genesis v%s\n", Version)
-				fmt.Printf("USAGE: genesis graph [pipeline-layout]\n\n")
+				fmt.Printf("USAGE: genesis graph [--format dot|mermaid|ascii] [pipeline-layout]\n\n")
 				fmt.Printf("OPTIONS\n")
 				fmt.Printf("  -c, --config     Path to the pipeline configuration file, which specifies\n")
 				fmt.Printf("                   Git parameters, notification settings, pipeline layouts,\n")
-				fmt.Printf("                   etc.  Defaults to 'ci.yml'\n")
+				fmt.Printf("                   etc.  Defaults to 'ci.yml'\n\n")
+				fmt.Printf("  -f, --format     How to draw the pipeline; one of 'dot' (for Graphviz,\n")
+				fmt.Printf("                   the default), 'mermaid' or 'ascii'.\n")
 				return nil
 			}
 
-			fmt.Printf("This is genesis graph.")
+			getopt.Reset()
+			config := getopt.StringLong("config", 'c', pipeline.DefaultConfig, "Path to the pipeline configuration file")
+			format := getopt.StringLong("format", 'f', pipeline.DOT, "How to draw the pipeline")
+
+			options := getopt.CommandLine
+			args = append([]string{"graph"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis graph [--format dot|mermaid|ascii] [--config ci.yml] [pipeline-layout]}\n")
+				os.Exit(3)
+			}
+			name := pipeline.DefaultLayout
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			c, err := pipeline.ReadConfig(*config)
+			if err != nil {
+				return err
+			}
+			l, err := c.ParseLayout(name)
+			if err != nil {
+				return err
+			}
+			s, err := c.Graph(l, *format)
+			if err != nil {
+				return err
+			}
+			os.Stdout.WriteString(s)
 			return nil
 		})
 
+	/* genesis history */
+	c.Dispatch("history", "Show the deployment history of an environment.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis history [--format FORMAT] [--limit N] deployment-env.yml\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -f, --format     How to format the history; one of 'table' (the default),\n")
+				fmt.Printf("                   'json' or 'csv'.\n\n")
+				fmt.Printf("  -n, --limit      Only show the N most recent deployments.\n")
+				return nil
+			}
+
+			getopt.Reset()
+			format := getopt.StringLong("format", 'f', "table", "How to format the history")
+			limit := getopt.IntLong("limit", 'n', 0, "Only show the N most recent deployments")
+
+			options := getopt.CommandLine
+			args = append([]string{"history"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis history [--format FORMAT] [--limit N] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			r, err := e.HistoryReport(*limit)
+			if err != nil {
+				return err
+			}
+			return r.Render(*format, os.Stdout)
+		})
+
+	/* genesis ips */
+	c.Dispatch("ips", "Show the static IPs allocated to environments.",
+		func(opts Options, args []string, help bool) error {
+			if help {
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis ips [--format FORMAT] [--offline] [env-glob ...]\n\n")
+				fmt.Printf("Environments ask for static IPs via params.static_ips, i.e.:\n\n")
+				fmt.Printf("    params:\n")
+				fmt.Printf("      static_ips:\n")
+				fmt.Printf("        - job:     consul\n")
+				fmt.Printf("          network: default\n")
+				fmt.Printf("          count:   3\n")
+				fmt.Printf("          azs:     [z1, z2]   # optional\n")
+				fmt.Printf("          offset:  0          # optional\n\n")
+				fmt.Printf("and kits use them via (( grab meta.static_ips.consul )).\n")
+				fmt.Printf("IPs are allocated from the network's static ranges in the\n")
+				fmt.Printf("cloud-config, and checked against every other environment\n")
+				fmt.Printf("that deploys to the same BOSH director.  Environments that\n")
+				fmt.Printf("have been deployed keep the static IPs they were deployed with.\n\n")
+				fmt.Printf("OPTIONS\n")
+				fmt.Printf("  -f, --format     How to format the report; one of 'table' (the default),\n")
+				fmt.Printf("                   'json' or 'csv'.\n\n")
+				fmt.Printf("      --offline    Use cached cloud-configs, instead of asking the directors.\n")
+				return nil
+			}
+
+			getopt.Reset()
+			format := getopt.StringLong("format", 'f', "table", "How to format the report")
+			offline := getopt.BoolLong("offline", 0, "Use cached cloud-configs")
+
+			options := getopt.CommandLine
+			args = append([]string{"ips"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			l, err := env.All(*opts.Cwd)
+			if err != nil {
+				return err
+			}
+			l, err = env.Filter(l, args)
+			if err != nil {
+				return err
+			}
+
+			r, err := env.StaticIPReport(l, *offline)
+			if err != nil {
+				return err
+			}
+			return r.Render(*format, os.Stdout)
+		})
+
 	/* genesis init */
 	// FIXME: implement
 	c.Dispatch("init", "Initialize a new Genesis deployment.",
@@ -250,7 +895,6 @@ func main() {
 		})
 
 	/* genesis lookup */
-	// FIXME: implement
 	c.Dispatch("lookup", "Find a key set in environment manifests.",
 		func(opts Options, args []string, help bool) error {
 			if help {
@@ -260,31 +904,129 @@ func main() {
 				return nil
 			}
 
-			fmt.Printf("This is genesis lookup.")
+			if len(args) != 3 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis lookup key env-name default-value}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[1])
+			if err != nil && !env.IsNotFound(err) {
+				return err
+			}
+
+			v, found, err := e.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			if !found || v == nil {
+				os.Stdout.WriteString(args[2] + "\n")
+				return nil
+			}
+
+			switch v.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				b, err := yaml.Marshal(v)
+				if err != nil {
+					return err
+				}
+				os.Stdout.Write(b)
+			default:
+				os.Stdout.WriteString(fmt.Sprintf("%v", v) + "\n")
+			}
 			return nil
 		})
 
 	/* genesis manifest */
-	// FIXME: implement
 	c.Dispatch("manifest", "Compile a deployment manifest.",
 		func(opts Options, args []string, help bool) error {
 			if help {
 				fmt.Printf("genesis v%s\n", Version)
-				fmt.Printf("USAGE: genesis manifest [--no-redact] [--cloud-config path.yml] deployment-env.yml\n\n")
+				fmt.Printf("USAGE: genesis manifest [--no-redact] [--cloud-config path.yml] [--format yaml|json] [--path key.path] [--params-only] deployment-env.yml\n\n")
 				fmt.Printf("OPTIONS\n")
 				fmt.Printf("$GLOBAL_USAGE\n\n")
-				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config\n\n")
+				fmt.Printf("  -c, --cloud-config PATH    Path to your downloaded BOSH cloud-config.\n")
+				fmt.Printf("                             By default, it is fetched from the director\n")
+				fmt.Printf("                             (or the copy cached by the last fetch).\n\n")
 				fmt.Printf("      --no-redact            Do not redact credentials in the manifest.\n")
-				fmt.Printf("                             USE THIS OPTION WITH GREAT CARE AND CAUTION.\n")
+				fmt.Printf("                             USE THIS OPTION WITH GREAT CARE AND CAUTION.\n\n")
+				fmt.Printf("  -f, --format FORMAT        How to format the manifest, one of yaml or\n")
+				fmt.Printf("                             json.  Defaults to yaml.\n\n")
+				fmt.Printf("  -p, --path KEY.PATH        Only print the part of the manifest at the\n")
+				fmt.Printf("                             given (spruce-style) path, i.e. jobs.thing\n\n")
+				fmt.Printf("      --params-only          Only print the merged params, not the whole\n")
+				fmt.Printf("                             manifest.  --path is relative to the params.\n")
 				return nil
 			}
 
-			fmt.Printf("This is genesis manifest.")
+			getopt.Reset()
+			cloud := getopt.StringLong("cloud-config", 'c', "", "Path to your downloaded BOSH cloud-config")
+			noredact := getopt.BoolLong("no-redact", 0, "Do not redact credentials in the manifest")
+			format := getopt.StringLong("format", 'f', "yaml", "How to format the manifest")
+			path := getopt.StringLong("path", 'p', "", "Only print the manifest at this path")
+			paramsonly := getopt.BoolLong("params-only", 0, "Only print the merged params")
+
+			options := getopt.CommandLine
+			args = append([]string{"manifest"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis manifest [--no-redact] [--cloud-config path.yml] [--format yaml|json] [--path key.path] [--params-only] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			k, err := e.Kit()
+			if err != nil {
+				return err
+			}
+
+			// not every kit needs a cloud-config; if we can't get one
+			// (from the director, or the cache), try going without.
+			var cerr error
+			if *cloud == "" {
+				*cloud, cerr = e.CloudConfig(false)
+			}
+
+			var b []byte
+			if *paramsonly {
+				b, err = e.Params(k, *cloud, !*noredact)
+			} else {
+				b, err = e.Manifest(k, *cloud, !*noredact)
+			}
+			if err != nil {
+				if x, ok := err.(kit.SubkitError); ok {
+					os.Stderr.WriteString(x.Message)
+					os.Exit(x.Code)
+				}
+				if cerr != nil {
+					fmt.Fprintf(os.Stderr, "@Y{(no cloud-config was available: %s)}\n", cerr)
+				}
+				return err
+			}
+
+			// --params-only gives us the params: top-level key,
+			// but --path is relative to the params themselves.
+			if *paramsonly {
+				if *path == "" {
+					*path = "params"
+				} else {
+					*path = "params." + *path
+				}
+			}
+			if *path != "" || *format != "yaml" {
+				if b, err = env.Format(b, *path, *format); err != nil {
+					return err
+				}
+			}
+			os.Stdout.Write(b)
 			return nil
 		})
 
 	/* genesis new */
-	// FIXME: implement
 	c.Dispatch("new", "Create a new Genesis deployment environment.",
 		func(opts Options, args []string, help bool) error {
 			if help {
@@ -293,10 +1035,61 @@ func main() {
 				fmt.Printf("OPTIONS\n")
 				fmt.Printf("      --vault      The name of a `safe' target (a Vault) to store newly\n")
 				fmt.Printf("                   generated credentials in.\n")
+				fmt.Printf("      --no-secrets Do not generate any credentials for the new environment.\n")
+				fmt.Printf("      --answers    A YAML file of answers to the questions the kit asks\n")
+				fmt.Printf("                   about its params.  Implies --non-interactive.\n")
+				fmt.Printf("      --non-interactive\n")
+				fmt.Printf("                   Don't ask any questions.  Params are taken from the\n")
+				fmt.Printf("                   --answers file, and $GENESIS_PARAM_* environment\n")
+				fmt.Printf("                   variables (i.e. $GENESIS_PARAM_DOMAIN for params.domain),\n")
+				fmt.Printf("                   falling back to the kit defaults.  If any required\n")
+				fmt.Printf("                   params are left unanswered, nothing is created.\n")
 				return nil
 			}
 
-			fmt.Printf("This is genesis new.")
+			getopt.Reset()
+			target := getopt.StringLong("vault", 0, "", "The name of a `safe' target (a Vault) to store newly generated credentials in")
+			nosecrets := getopt.BoolLong("no-secrets", 0, "Do not generate credentials for the new environment")
+			answersfile := getopt.StringLong("answers", 0, "", "YAML file of answers to the kit's questions")
+			yes := getopt.BoolLong("yes", 'y', "Accept defaults for anything not answered")
+			batch := getopt.BoolLong("non-interactive", 0, "Never prompt; take answers from --answers and $GENESIS_PARAM_*")
+
+			options := getopt.CommandLine
+			args = append([]string{"new"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis new [--vault target] env-name[.yml]}\n")
+				os.Exit(3)
+			}
+
+			k, err := currentKit()
+			if err != nil {
+				return err
+			}
+
+			answers := env.Answers{}
+			if *answersfile != "" {
+				answers, err = env.LoadAnswers(*answersfile)
+				if err != nil {
+					return err
+				}
+			}
+			for name, v := range env.EnvironmentAnswers(k, os.Environ()) {
+				answers[name] = v
+			}
+
+			e, err := env.Create(*opts.Cwd, args[0], k, env.NewOptions{
+				Vault:     vault.Vault{Target: *target},
+				NoSecrets: *nosecrets,
+				Answers:   answers,
+				Yes:       *opts.Yes || *yes || *batch || *answersfile != "",
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("@G{%s created}\n", e.File())
 			return nil
 		})
 
@@ -316,7 +1109,6 @@ func main() {
 		})
 
 	/* genesis repipe */
-	// FIXME: implement
 	c.Dispatch("repipe", "Configure a Concourse pipeline for automating deployments.",
 		func(opts Options, args []string, help bool) error {
 			if help {
@@ -324,22 +1116,67 @@ func main() {
 				fmt.Printf("USAGE: genesis repipe [pipeline-layout]\n\n")
 				fmt.Printf("OPTIONS\n")
 				fmt.Printf("  -t, --target     The name of your Concourse target (per `fly targets'),\n")
-				fmt.Printf("                   if it differs from the pipeline layout name.\n\n")
+				fmt.Printf("                   if it differs from the name of the pipeline.\n\n")
 				fmt.Printf("  -n, --dry-run    Generate the Concourse Pipeline configuration, but\n")
 				fmt.Printf("                   refrain from actually deploying it to Concourse.\n")
 				fmt.Printf("                   Instead, just print the YAML.\n\n")
+				fmt.Printf("  -y, --yes        Don't ask for confirmation before changing the\n")
+				fmt.Printf("                   pipeline (fly still shows what's changing).\n\n")
 				fmt.Printf("  -c, --config     Path to the pipeline configuration file, which specifies\n")
 				fmt.Printf("                   Git parameters, notification settings, pipeline layouts,\n")
 				fmt.Printf("                   etc.  Defaults to 'ci.yml'\n")
 				return nil
 			}
 
-			fmt.Printf("This is genesis repipe.")
-			return nil
+			getopt.Reset()
+			target := getopt.StringLong("target", 't', "", "The name of your Concourse target")
+			yes := getopt.BoolLong("yes", 'y', "Don't ask for confirmation")
+			dryrun := getopt.BoolLong("dry-run", 'n', "Print the pipeline configuration, instead of deploying it")
+			config := getopt.StringLong("config", 'c', pipeline.DefaultConfig, "Path to the pipeline configuration file")
+
+			options := getopt.CommandLine
+			args = append([]string{"repipe"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis repipe [--dry-run] [--yes] [--target NAME] [--config ci.yml] [pipeline-layout]}\n")
+				os.Exit(3)
+			}
+			name := pipeline.DefaultLayout
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			c, err := pipeline.ReadConfig(*config)
+			if err != nil {
+				return err
+			}
+			l, err := c.Layout(name, *opts.Cwd)
+			if err != nil {
+				return err
+			}
+			p := c.Pipeline(l)
+
+			if *dryrun {
+				b, err := p.YAML()
+				if err != nil {
+					return err
+				}
+				os.Stdout.Write(b)
+				return nil
+			}
+
+			if *target == "" {
+				*target = c.Name
+			}
+			return c.Apply(l, p, pipeline.Concourse{
+				Target:      *target,
+				Interactive: !*opts.Yes && !*yes,
+			})
 		})
 
 	/* genesis secrets */
-	// FIXME: implement
 	c.Dispatch("secrets", "Re-generate // rotate credentials (passwords, keys, etc.).",
 		func(opts Options, args []string, help bool) error {
 			if help {
@@ -353,24 +1190,88 @@ func main() {
 				return nil
 			}
 
-			fmt.Printf("This is genesis secrets.")
-			return nil
+			getopt.Reset()
+			target := getopt.StringLong("vault", 0, "", "The name of a `safe' target (a Vault) to store newly generated credentials in")
+			rotate := getopt.BoolLong("rotate", 0, "Rotate credentials")
+
+			options := getopt.CommandLine
+			args = append([]string{"secrets"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "@R{USAGE: genesis secrets [--rotate] [--vault target] deployment-env.yml}\n")
+				os.Exit(3)
+			}
+
+			e, err := env.Load(*opts.Cwd, args[0])
+			if err != nil {
+				return err
+			}
+			k, err := e.Kit()
+			if err != nil {
+				return err
+			}
+			features, err := k.Subkits(e.Name, e.Param)
+			if err != nil {
+				return err
+			}
+
+			written, err := e.Secrets(k, vault.Vault{Target: *target}, features, *rotate)
+			for _, path := range written {
+				fmt.Printf("  - generated @C{%s}\n", path)
+			}
+			return err
 		})
 
 	/* genesis summary */
-	// FIXME: implement
 	c.Dispatch("summary", "Print a summary of defined environments.",
 		func(opts Options, args []string, help bool) error {
 			if help {
-				fmt.Printf("genesis v$VERSION\n")
-				fmt.Printf("USAGE: genesis summary\n\n")
+				fmt.Printf("genesis v%s\n", Version)
+				fmt.Printf("USAGE: genesis summary [--format FORMAT] [--columns COLUMNS] [env-glob ...]\n\n")
 				fmt.Printf("OPTIONS\n")
-				fmt.Printf("$GLOBAL_USAGE\n")
+				fmt.Printf("  -f, --format     How to format the summary; one of 'table' (the default),\n")
+				fmt.Printf("                   'json' or 'csv'.\n\n")
+				fmt.Printf("  -c, --columns    A comma-separated list of columns to report on.  Defaults\n")
+				fmt.Printf("                   to 'env,kit,last'.  Valid columns are:\n\n")
+				fmt.Printf("                     env         Name of the environment\n")
+				fmt.Printf("                     kit         Kit name and (resolved) version\n")
+				fmt.Printf("                     name        Kit name\n")
+				fmt.Printf("                     constraint  Kit version, as requested in params.version\n")
+				fmt.Printf("                     resolved    Kit version actually in use\n")
+				fmt.Printf("                     last        When the environment was last deployed\n")
+				fmt.Printf("                     age         How many days ago that was\n")
+				fmt.Printf("                     director    The BOSH director the environment deploys to\n")
+				fmt.Printf("                     vault       Where its credentials are kept in the Vault\n")
+				fmt.Printf("                     upgrade     Newer version of the kit, if one is available\n\n")
+				fmt.Printf("Times are formatted per $GENESIS_TIME_FORMAT (a strftime(3) format).\n")
 				return nil
 			}
 
-			fmt.Printf("This is genesis summary.")
-			return nil
+			getopt.Reset()
+			format := getopt.StringLong("format", 'f', "table", "How to format the summary")
+			columns := getopt.StringLong("columns", 'c', strings.Join(env.DefaultSummaryColumns, ","), "Columns to report on")
+
+			options := getopt.CommandLine
+			args = append([]string{"summary"}, args...)
+			options.Parse(args)
+			args = options.Args()
+
+			l, err := env.All(*opts.Cwd)
+			if err != nil {
+				return err
+			}
+			l, err = env.Filter(l, args)
+			if err != nil {
+				return err
+			}
+
+			r, err := env.Summary(l, strings.Split(*columns, ","))
+			if err != nil {
+				return err
+			}
+			return r.Render(*format, os.Stdout)
 		})
 
 	/* genesis version */
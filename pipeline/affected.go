@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/jhunt/genesis/env"
+)
+
+// Work out what the pipeline does with a set of changed files, given the
+// environments they affect directly: changes to the pipeline configuration
+// (config, relative to the repo) affect every environment's stage of the
+// pipeline, changes to the files that an environment propagates (in
+// .genesis/cached/ENV/) trigger the environments downstream that watch
+// them, and everything downstream of an affected environment follows it.
+// Environments are returned in pipeline order, followed by any that
+// aren't in the pipeline, in the order given.
+func (l *Layout) Affected(config string, files []string, direct []env.Impact) []env.Impact {
+	// environments affected in more than one way are reported for the
+	// most direct of them
+	rank := map[string]int{env.Downstream: 0, env.Pipeline: 1, env.Directly: 2}
+	impacts := make(map[string]*env.Impact)
+	affect := func(name, how string, because ...string) {
+		if i, ok := impacts[name]; ok && rank[how] <= rank[i.How] {
+			if how == i.How {
+				for _, b := range because {
+					if !among(b, i.Because) {
+						i.Because = append(i.Because, b)
+					}
+				}
+			}
+			return
+		}
+		impacts[name] = &env.Impact{Env: name, How: how, Because: append([]string{}, because...)}
+	}
+	for _, i := range direct {
+		affect(i.Env, i.How, i.Because...)
+	}
+
+	cached := env.CachedDirectory + "/"
+	for _, file := range files {
+		if filepath.Clean(file) == filepath.Clean(config) {
+			for _, name := range l.Envs {
+				affect(name, env.Pipeline, file)
+			}
+			continue
+		}
+		if !strings.HasPrefix(file, cached) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(file, cached), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		for _, next := range l.Downstream(parts[0]) {
+			if among(parts[1], shared(next)) {
+				affect(next, env.Pipeline, file)
+			}
+		}
+	}
+
+	for _, name := range l.Sorted() {
+		if _, ok := impacts[name]; !ok {
+			continue
+		}
+		for _, next := range l.Downstream(name) {
+			affect(next, env.Downstream, name)
+		}
+	}
+
+	sorted := make([]env.Impact, 0, len(impacts))
+	for _, name := range l.Sorted() {
+		if i, ok := impacts[name]; ok {
+			sorted = append(sorted, *i)
+			delete(impacts, name)
+		}
+	}
+	for _, i := range direct {
+		if left, ok := impacts[i.Env]; ok {
+			sorted = append(sorted, *left)
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,338 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/genesis/env"
+	"gopkg.in/yaml.v2"
+)
+
+// The bits of Concourse pipeline configuration that we generate; see
+// https://concourse-ci.org/pipelines.html for what they all mean.
+
+type Group struct {
+	Name string   `yaml:"name"`
+	Jobs []string `yaml:"jobs"`
+}
+
+type Step struct {
+	Aggregate []Step                 `yaml:"aggregate,omitempty"`
+	Get       string                 `yaml:"get,omitempty"`
+	Passed    *[]string              `yaml:"passed,omitempty"`
+	Trigger   bool                   `yaml:"trigger,omitempty"`
+	Put       string                 `yaml:"put,omitempty"`
+	Task      string                 `yaml:"task,omitempty"`
+	Tags      []string               `yaml:"tags,omitempty"`
+	Config    *Task                  `yaml:"config,omitempty"`
+	Params    map[string]interface{} `yaml:"params,omitempty"`
+}
+
+type Input struct {
+	Name string `yaml:"name"`
+}
+
+type Task struct {
+	Platform      string `yaml:"platform"`
+	ImageResource struct {
+		Type   string            `yaml:"type"`
+		Source map[string]string `yaml:"source"`
+	} `yaml:"image_resource"`
+	Inputs  []Input `yaml:"inputs"`
+	Outputs []Input `yaml:"outputs,omitempty"`
+	Run     struct {
+		Path string   `yaml:"path"`
+		Args []string `yaml:"args"`
+	} `yaml:"run"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+type Job struct {
+	Name      string `yaml:"name"`
+	Public    bool   `yaml:"public"`
+	Serial    bool   `yaml:"serial"`
+	Plan      []Step `yaml:"plan"`
+	OnSuccess *Step  `yaml:"on_success,omitempty"`
+	OnFailure *Step  `yaml:"on_failure,omitempty"`
+}
+
+type Resource struct {
+	Name   string                 `yaml:"name"`
+	Type   string                 `yaml:"type"`
+	Source map[string]interface{} `yaml:"source"`
+}
+
+type Pipeline struct {
+	Groups        []Group    `yaml:"groups"`
+	Jobs          []Job      `yaml:"jobs"`
+	ResourceTypes []Resource `yaml:"resource_types"`
+	Resources     []Resource `yaml:"resources"`
+}
+
+// The credentials that the `bosh` CLI needs to talk to an environment's
+// director, aliased as `default`.
+func (c Config) boshConfig(name string) string {
+	b := c.Boshes[name]
+	return fmt.Sprintf("auth:\n  %s:\n    username: %s\n    password: %s\nalias:\n  target:\n    default: %s\n",
+		b.URL, b.Username, c.secret(name+"-bosh-password", b.Password), b.URL)
+}
+
+func (c Config) task(name string, args []string, inputs ...string) *Task {
+	t := &Task{Platform: "linux"}
+	t.ImageResource.Type = "docker-image"
+	t.ImageResource.Source = map[string]string{
+		"repository": c.Task.Image,
+		"tag":        c.Task.Version,
+	}
+	for _, in := range inputs {
+		t.Inputs = append(t.Inputs, Input{Name: in})
+	}
+	t.Run.Path = name
+	t.Run.Args = args
+	return t
+}
+
+func (c Config) tags(name string) []string {
+	if c.Tagged {
+		return []string{name}
+	}
+	return nil
+}
+
+func (c Config) git(paths []string) map[string]interface{} {
+	source := map[string]interface{}{
+		"uri":         fmt.Sprintf("git@github.com:%s/%s", c.Github.Owner, c.Github.Repo),
+		"branch":      c.Github.Branch,
+		"private-key": c.secret("github-private-key", c.Github.PrivateKey),
+	}
+	if paths != nil {
+		source["paths"] = paths
+	}
+	return source
+}
+
+// The files shared between an environment and the ones above it in the
+// hierarchy, from least specific to most; us-west-1-prod shares us.yml,
+// us-west.yml and us-west-1.yml.  They don't have to exist.
+func shared(name string) []string {
+	parts := strings.Split(name, "-")
+	l := make([]string, 0, len(parts)-1)
+	for i := 1; i < len(parts); i++ {
+		l = append(l, strings.Join(parts[:i], "-")+".yml")
+	}
+	return l
+}
+
+// The files that trigger a deployment of this environment: for the ones
+// at the top of the pipeline, all of its (shared) files; for everything
+// else, its own file and the shared files, as they were cached by the
+// last successful deployment of each upstream environment.
+func (l *Layout) watches(name string) []string {
+	files := shared(name)
+	up := l.Upstream(name)
+	if len(up) == 0 {
+		return append(files, name+".yml")
+	}
+
+	paths := make([]string, 0)
+	for _, u := range up {
+		for _, file := range files {
+			paths = append(paths, filepath.Join(env.CachedDirectory, u, file))
+		}
+	}
+	return append(paths, name+".yml")
+}
+
+// The upstream environments that someone has to approve deploys of
+// name after, and the ones they don't.
+func (l *Layout) gates(name string) ([]string, []string) {
+	gated, ungated := make([]string, 0), make([]string, 0)
+	for _, up := range l.Upstream(name) {
+		if l.Gated(up, name) {
+			gated = append(gated, up)
+		} else {
+			ungated = append(ungated, up)
+		}
+	}
+	return gated, ungated
+}
+
+func approval(name string) string {
+	return "approve-" + name
+}
+
+// The job that someone has to run, by hand, to approve a deploy of name;
+// all it does is pass the changes (from the gated upstreams) along.
+func (c Config) approval(l *Layout, name string) Job {
+	gated, _ := l.gates(name)
+	return Job{
+		Name:   approval(name),
+		Public: *c.Public,
+		Serial: true,
+		Plan:   []Step{{Get: name + "-changes", Passed: &gated}},
+	}
+}
+
+// The resource that only fires inside of an environment's deployment window.
+func window(name string, w Window) Resource {
+	source := map[string]interface{}{
+		"start": w.Start,
+		"stop":  w.Stop,
+	}
+	if len(w.Days) > 0 {
+		source["days"] = w.Days
+	}
+	if w.Location != "" {
+		source["location"] = w.Location
+	}
+	return Resource{Name: name + "-window", Type: "time", Source: source}
+}
+
+func (c Config) job(l *Layout, name string) Job {
+	gated, passed := l.gates(name)
+	if len(gated) > 0 {
+		passed = append(passed, approval(name))
+		sort.Strings(passed)
+	}
+
+	deploy := c.task("code/bin/genesis", []string{"ci", "pipeline", "stage1"}, "code-changes", "config-changes")
+	deploy.Outputs = []Input{{Name: "out"}}
+	deploy.Params = map[string]interface{}{
+		"BOSH_CONFIG":     c.boshConfig(name),
+		"BOSH_TARGET":     "default",
+		"CURRENT_ENV":     name,
+		"GIT_BRANCH":      c.Github.Branch,
+		"GIT_PRIVATE_KEY": c.secret("github-private-key", c.Github.PrivateKey),
+		"VAULT_ADDR":      c.Vault.URL,
+		"VAULT_APP_ID":    c.Vault.App,
+		"VAULT_USER_ID":   c.Vault.User,
+		"WORKING_DIR":     "out/git",
+	}
+	if c.Vault.Verify != nil && !*c.Vault.Verify {
+		deploy.Params["VAULT_SKIP_VERIFY"] = 1
+	} else {
+		deploy.Params["VAULT_SKIP_VERIFY"] = nil
+	}
+
+	j := Job{
+		Name:   name,
+		Public: *c.Public,
+		Serial: true,
+		Plan: []Step{
+			{Aggregate: []Step{
+				{Get: "code-changes"},
+				{Get: name + "-changes", Passed: &passed},
+			}},
+			{Task: name, Config: deploy, Tags: c.tags(name)},
+			{Put: "git", Params: map[string]interface{}{
+				"repository": "out/git",
+				"rebase":     true,
+			}},
+		},
+	}
+
+	// stage1 refuses to deploy outside of the window; only environments
+	// that would have deployed on their own wait for it to open.
+	if w, ok := l.Windows[name]; ok {
+		deploy.Params["DEPLOY_WINDOW"] = w.Spec
+		if l.Automatic(name) && len(gated) == 0 {
+			j.Plan[0].Aggregate = append(j.Plan[0].Aggregate, Step{Get: name + "-window", Trigger: true})
+		}
+	}
+
+	if c.Smoke != "" {
+		smoke := c.task("out/git/bin/genesis", []string{"ci", "pipeline", "run-smoke-test"}, "out")
+		smoke.Params = map[string]interface{}{
+			"CURRENT_ENV": name,
+			"ERRAND_NAME": c.Smoke,
+			"BOSH_TARGET": "default",
+			"BOSH_CONFIG": c.boshConfig(name),
+		}
+		j.Plan = append(j.Plan, Step{Task: "smoke-test", Config: smoke, Tags: c.tags(name)})
+	}
+
+	// let people know how it went, and who's waiting on them next
+	done := []event{{env: name, kind: Success}}
+	for _, next := range l.Downstream(name) {
+		if !l.Automatic(next) || l.Gated(name, next) {
+			done = append(done, event{env: next, kind: Pending})
+		}
+	}
+	j.OnSuccess = c.notifications(done...)
+	j.OnFailure = c.notifications(event{env: name, kind: Failure})
+	return j
+}
+
+// Generate the Concourse pipeline for a (checked) layout: one job per
+// environment, each of which waits for its upstream environments to be
+// deployed before deploying, and a git resource per environment to
+// watch for changes to its files.
+func (c Config) Pipeline(l *Layout) Pipeline {
+	names := append([]string{}, l.Envs...)
+	sort.Strings(names)
+
+	p := Pipeline{
+		ResourceTypes: []Resource{
+			{Name: "script", Type: "docker-image", Source: map[string]interface{}{"repository": "cfcommunity/script-resource"}},
+			{Name: "email", Type: "docker-image", Source: map[string]interface{}{"repository": "pcfseceng/email-resource"}},
+			{Name: "slack-notification", Type: "docker-image", Source: map[string]interface{}{"repository": "cfcommunity/slack-notification-resource"}},
+		},
+		Resources: []Resource{
+			{Name: "git", Type: "git", Source: c.git(nil)},
+			{Name: "code-changes", Type: "git", Source: c.git([]string{"bin/genesis"})},
+		},
+	}
+
+	for _, name := range names {
+		if gated, _ := l.gates(name); len(gated) > 0 {
+			p.Jobs = append(p.Jobs, c.approval(l, name))
+		}
+		p.Jobs = append(p.Jobs, c.job(l, name))
+		p.Resources = append(p.Resources, Resource{
+			Name:   name + "-changes",
+			Type:   "git",
+			Source: c.git(l.watches(name)),
+		})
+		if w, ok := l.Windows[name]; ok && l.Automatic(name) {
+			if gated, _ := l.gates(name); len(gated) == 0 {
+				p.Resources = append(p.Resources, window(name, w))
+			}
+		}
+	}
+
+	jobs := make([]string, len(p.Jobs))
+	for i, j := range p.Jobs {
+		jobs[i] = j.Name
+	}
+	p.Groups = []Group{{Name: "*", Jobs: jobs}}
+
+	teams := false
+	for _, n := range c.Notifications {
+		if r, ok := c.notifier(n); ok {
+			p.Resources = append(p.Resources, r)
+		}
+		teams = teams || n.Type == Teams
+	}
+	if teams {
+		p.ResourceTypes = append(p.ResourceTypes, Resource{
+			Name:   "teams-notification",
+			Type:   "docker-image",
+			Source: map[string]interface{}{"repository": "navicore/teams-notification-resource"},
+		})
+	}
+
+	if c.Slack.Webhook != "" {
+		p.Resources = append(p.Resources, Resource{
+			Name:   "slack",
+			Type:   "slack-notification",
+			Source: map[string]interface{}{"url": c.secret("slack-webhook", c.Slack.Webhook)},
+		})
+	}
+	return p
+}
+
+func (p Pipeline) YAML() ([]byte, error) {
+	return yaml.Marshal(p)
+}
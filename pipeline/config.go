@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DefaultConfig = "ci.yml"
+	DefaultLayout = "default"
+
+	DefaultImage    = "starkandwayne/concourse"
+	DefaultVersion  = "latest"
+	DefaultVaultApp = "concourse"
+	DefaultBranch   = "master"
+)
+
+// A Bosh director that one environment in the pipeline deploys to.
+type Bosh struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// A Config is the `pipeline:` section of a pipeline configuration file
+// (ci.yml, by default), i.e.
+//
+//	pipeline:
+//	  name: aws-1
+//	  boshes:
+//	    us-east-1-sandbox:
+//	      url:      https://10.4.0.6:25555
+//	      username: admin
+//	      password: sekrit
+//	  layouts:
+//	    default: |
+//	      auto *sandbox
+//	      us-east-1-sandbox -> us-east-1-prod
+//	  github:
+//	    owner: someco
+//	    repo:  something-deployments
+//	    private-key: (( vault "secret/concourse/github:private" ))
+//
+// Configuration files are merged with spruce before they are read, so
+// they can use operators like (( grab ... )).
+//
+// Normally, credentials (BOSH passwords, the GitHub private key, etc.)
+// are written straight into the pipeline.  Setting credentials.path
+// keeps them out of it, by way of Concourse's credential manager; see
+// credentials.go.
+type Config struct {
+	Name   string `yaml:"name"`
+	Public *bool  `yaml:"public"`
+	Tagged bool   `yaml:"tagged"`
+
+	Smoke      string `yaml:"smoke"`
+	SmokeTests string `yaml:"smoke-tests"`
+
+	Task struct {
+		Image   string `yaml:"image"`
+		Version string `yaml:"version"`
+	} `yaml:"task"`
+
+	Vault struct {
+		URL    string `yaml:"url"`
+		App    string `yaml:"app"`
+		User   string `yaml:"user"`
+		Verify *bool  `yaml:"verify"`
+	} `yaml:"vault"`
+
+	Boshes  map[string]Bosh   `yaml:"boshes"`
+	Layouts map[string]string `yaml:"layouts"`
+
+	Github struct {
+		Owner      string `yaml:"owner"`
+		Repo       string `yaml:"repo"`
+		Branch     string `yaml:"branch"`
+		PrivateKey string `yaml:"private-key"`
+	} `yaml:"github"`
+
+	Slack struct {
+		Channel string `yaml:"channel"`
+		Webhook string `yaml:"webhook"`
+	} `yaml:"slack"`
+
+	Notifications []Notification `yaml:"notifications"`
+
+	Credentials struct {
+		Path   string `yaml:"path"`
+		Target string `yaml:"target"`
+	} `yaml:"credentials"`
+}
+
+// Read a pipeline configuration file, filling in defaults for anything
+// that was left out.
+func ReadConfig(file string) (Config, error) {
+	var c Config
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("spruce", "merge", file)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return c, fmt.Errorf("failed to merge %s: %s", file, strings.TrimSpace(stderr.String()))
+	}
+
+	var doc struct {
+		Pipeline *Config `yaml:"pipeline"`
+	}
+	if err := yaml.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		return c, fmt.Errorf("%s: %s", file, err)
+	}
+	if doc.Pipeline == nil {
+		return c, fmt.Errorf("%s: no pipeline: configuration found", file)
+	}
+	c = *doc.Pipeline
+
+	if c.Name == "" {
+		return c, fmt.Errorf("%s: pipeline.name is required", file)
+	}
+	if c.Github.Owner == "" || c.Github.Repo == "" {
+		return c, fmt.Errorf("%s: pipeline.github.owner and pipeline.github.repo are required", file)
+	}
+	if c.Vault.URL == "" {
+		return c, fmt.Errorf("%s: pipeline.vault.url is required", file)
+	}
+
+	for i := range c.Notifications {
+		if err := c.Notifications[i].check(i + 1); err != nil {
+			return c, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+
+	if c.Public == nil {
+		yes := true
+		c.Public = &yes
+	}
+	if c.Smoke == "" {
+		c.Smoke = c.SmokeTests
+	}
+	if c.Task.Image == "" {
+		c.Task.Image = DefaultImage
+	}
+	if c.Task.Version == "" {
+		c.Task.Version = DefaultVersion
+	}
+	if c.Vault.App == "" {
+		c.Vault.App = DefaultVaultApp
+	}
+	if c.Vault.User == "" {
+		c.Vault.User = c.Name
+	}
+	if c.Github.Branch == "" {
+		c.Github.Branch = DefaultBranch
+	}
+	return c, nil
+}
+
+// The names of all the BOSH directors, sorted.
+func (c Config) Directors() []string {
+	l := make([]string, 0, len(c.Boshes))
+	for name := range c.Boshes {
+		l = append(l, name)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Parse one of the layouts from the configuration.
+func (c Config) ParseLayout(name string) (*Layout, error) {
+	src, ok := c.Layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("pipeline layout '%s' is not defined", name)
+	}
+	return Parse(name, src)
+}
+
+// Parse one of the layouts from the configuration, and check it against
+// the deployments repo at root.
+func (c Config) Layout(name, root string) (*Layout, error) {
+	l, err := c.ParseLayout(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.Check(root, c.Directors()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/genesis/vault"
+)
+
+// With credentials.path set in the pipeline configuration, i.e.
+//
+//	pipeline:
+//	  credentials:
+//	    path:   secret/concourse/main
+//	    target: ops-vault
+//
+// the pipeline only refers to credentials, as ((var)), and they are
+// copied into the Vault (the `safe` target, if given) under
+// PATH/PIPELINE/var, in the `value` key, which is where Concourse's
+// credential manager looks for them when it runs the pipeline.  PATH
+// should be the credential manager's path prefix, plus the team name.
+
+func (c Config) managed() bool {
+	return c.Credentials.Path != ""
+}
+
+// A credential, or a reference to it, if they are managed by Concourse.
+func (c Config) secret(name, value string) string {
+	if c.managed() {
+		return "((" + name + "))"
+	}
+	return value
+}
+
+// All of the credentials the pipeline needs, by name.
+func (c Config) Secrets(l *Layout) map[string]string {
+	m := make(map[string]string)
+	if c.Github.PrivateKey != "" {
+		m["github-private-key"] = c.Github.PrivateKey
+	}
+	if c.Slack.Webhook != "" {
+		m["slack-webhook"] = c.Slack.Webhook
+	}
+	for _, n := range c.Notifications {
+		switch n.Type {
+		case Slack, Teams:
+			m[n.resource()+"-webhook"] = n.Webhook
+		case Webhook:
+			m[n.resource()+"-url"] = n.URL
+		case Email:
+			m[n.resource()+"-password"] = n.SMTP.Password
+		}
+	}
+	for _, name := range l.Envs {
+		if b, ok := c.Boshes[name]; ok {
+			m[name+"-bosh-password"] = b.Password
+		}
+	}
+	return m
+}
+
+// Where Concourse will look for a credential, in the Vault.
+func (c Config) SecretPath(name string) string {
+	return strings.TrimSuffix(c.Credentials.Path, "/") + "/" + c.Name + "/" + name
+}
+
+// Copy the pipeline's credentials into the Vault, for Concourse's
+// credential manager to find.  Does nothing unless credentials.path
+// is set; credentials that aren't set are left alone.
+func (c Config) Seed(l *Layout) error {
+	if !c.managed() {
+		return nil
+	}
+
+	m := c.Secrets(l)
+	names := make([]string, 0, len(m))
+	for name, value := range m {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	v := vault.Vault{Target: c.Credentials.Target}
+	for _, name := range names {
+		if err := v.Set(c.SecretPath(name), "value", m[name]); err != nil {
+			return fmt.Errorf("unable to store %s in the Vault: %s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// How deploys of name (after from) are triggered, and when they can happen.
+func (l *Layout) trigger(from, name string) string {
+	how := "manual trigger"
+	if l.Automatic(name) {
+		how = "automatically"
+	}
+	if l.Gated(from, name) {
+		how = "after approval, " + how
+	}
+	if w, ok := l.Windows[name]; ok {
+		how += ", " + w.Spec + " only"
+	}
+	return how
+}
+
+func (l *Layout) list(from string, names []string) string {
+	s := make([]string, len(names))
+	for i, name := range names {
+		s[i] = fmt.Sprintf("%s (%s)", name, l.trigger(from, name))
+	}
+	if len(s) == 1 {
+		return s[0]
+	}
+	return strings.Join(s[:len(s)-1], ", ") + " and " + s[len(s)-1]
+}
+
+// Follow changes from an environment for as long as they go in a straight
+// line, describing each step; returns the sentence, and the environments
+// where the line splits (or merges), which need sentences of their own.
+func (l *Layout) follow(name, sentence string) (string, []string) {
+	for first := true; ; first = false {
+		next := l.Downstream(name)
+		if len(next) == 0 {
+			return sentence + ".", nil
+		}
+		if first {
+			sentence += l.list(name, next)
+		} else {
+			sentence += " and then to " + l.list(name, next)
+		}
+		if len(next) > 1 || len(l.Upstream(next[0])) > 1 {
+			return sentence + ".", next
+		}
+		name = next[0]
+	}
+}
+
+// Describe a layout: draw it (as a tree), and then explain in words how
+// changes make their way through the pipeline, and which BOSH director
+// (and Vault) each environment uses.  Only URLs are ever mentioned,
+// never credentials.
+func (c Config) Describe(l *Layout) string {
+	var out bytes.Buffer
+	out.WriteString(l.Tree(func(name string) string { return name }))
+	out.WriteString("\n")
+
+	done := make(map[string]bool)
+	for _, root := range l.Roots() {
+		how := "automatically"
+		if !l.Automatic(root) {
+			how = "by hand (manual trigger)"
+		}
+		if w, ok := l.Windows[root]; ok {
+			how += ", " + w.Spec + " only"
+		}
+		s := fmt.Sprintf("Changes to %s are deployed %s.", root, how)
+		var pending []string
+		if len(l.Downstream(root)) > 0 {
+			s, pending = l.follow(root, fmt.Sprintf("Changes to %s are deployed %s; once successful they propagate to ", root, how))
+		}
+		out.WriteString(s + "\n")
+
+		for len(pending) > 0 {
+			name := pending[0]
+			pending = pending[1:]
+			if done[name] || len(l.Downstream(name)) == 0 {
+				continue
+			}
+			done[name] = true
+			s, more := l.follow(name, fmt.Sprintf("From %s, they propagate to ", name))
+			out.WriteString(s + "\n")
+			pending = append(pending, more...)
+		}
+		if c.Smoke != "" {
+			fmt.Fprintf(&out, "Smoke test `%s` runs after each deployment.\n", c.Smoke)
+		}
+		out.WriteString("\n")
+	}
+
+	for _, name := range l.Sorted() {
+		if b, ok := c.Boshes[name]; ok && b.URL != "" {
+			fmt.Fprintf(&out, "%s deploys to the BOSH director at %s.\n", name, b.URL)
+		} else {
+			fmt.Fprintf(&out, "%s has no BOSH director.\n", name)
+		}
+	}
+	fmt.Fprintf(&out, "Credentials for all environments come from the Vault at %s.\n", c.Vault.URL)
+	return out.String()
+}
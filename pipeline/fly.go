@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// A Concourse, as known to the fly CLI (by target name, per `fly -t`).
+// All interaction goes through the CLI, so that operators' ~/.flyrc
+// (and its auth tokens) are honored.
+type Concourse struct {
+	Target      string
+	Interactive bool
+}
+
+// run a fly command, talking directly to the operator via our standard
+// input / output / error.
+func (c Concourse) run(args ...string) error {
+	cmd := exec.Command("fly", append([]string{"-t", c.Target}, args...)...)
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("`fly %s` failed: %s", args[0], err)
+	}
+	return nil
+}
+
+// Configure a pipeline from a file on disk.  fly shows what's changing,
+// and (if we're interactive) asks for confirmation before going ahead.
+func (c Concourse) SetPipeline(name, file string) error {
+	args := []string{"set-pipeline", "-p", name, "-c", file}
+	if !c.Interactive {
+		args = append(args, "--non-interactive")
+	}
+	return c.run(args...)
+}
+
+func (c Concourse) Unpause(name string) error {
+	return c.run("unpause-pipeline", "-p", name)
+}
+
+// Make the pipeline visible to people who aren't logged in.
+func (c Concourse) Expose(name string) error {
+	return c.run("expose-pipeline", "-p", name)
+}
+
+// Configure, unpause and (if it's public) expose the pipeline (the one
+// for layout l).  Its credentials are only copied into the Vault once
+// the change has been confirmed, and before the pipeline is unpaused.
+func (c Config) Apply(l *Layout, p Pipeline, fly Concourse) error {
+	b, err := p.YAML()
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "genesis-pipeline-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+
+	if err := fly.SetPipeline(c.Name, f.Name()); err != nil {
+		return err
+	}
+	if err := c.Seed(l); err != nil {
+		return err
+	}
+	if err := fly.Unpause(c.Name); err != nil {
+		return err
+	}
+	if *c.Public {
+		return fly.Expose(c.Name)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	DOT     = "dot"
+	Mermaid = "mermaid"
+	ASCII   = "ascii"
+)
+
+var GraphFormats = []string{DOT, Mermaid, ASCII}
+
+// What we know about an environment, for drawing it: how it's triggered,
+// when it can be deployed, which BOSH director it deploys to, and the
+// smoke test run after.
+func (c Config) notes(l *Layout, name string) []string {
+	notes := []string{"manual"}
+	if l.Automatic(name) {
+		notes[0] = "auto"
+	}
+	if w, ok := l.Windows[name]; ok {
+		notes = append(notes, "window "+w.Spec)
+	}
+	if b, ok := c.Boshes[name]; ok && b.URL != "" {
+		notes = append(notes, "bosh "+b.URL)
+	}
+	if c.Smoke != "" {
+		notes = append(notes, "smoke test "+c.Smoke)
+	}
+	return notes
+}
+
+// Draw a layout as an (indented) tree, one per environment at the top
+// of the pipeline, i.e.
+//
+//	us-east-1-sandbox
+//	  |--> us-east-1-preprod
+//	  |     `--> us-east-1-prod
+//	  `--> [approve] us-west-1-prod
+//
+// Environments that follow more than one other show up in more than one
+// tree.  Each environment is drawn as whatever label returns for it,
+// after the gate (if any) on the way to it.
+func (l *Layout) Tree(label func(string) string) string {
+	var out bytes.Buffer
+
+	var draw func(string, string)
+	draw = func(name, prefix string) {
+		next := l.Downstream(name)
+		for i, d := range next {
+			gate := ""
+			if l.Gated(name, d) {
+				gate = "[approve] "
+			}
+			if i == len(next)-1 {
+				fmt.Fprintf(&out, "%s`--> %s%s\n", prefix, gate, label(d))
+				draw(d, prefix+"      ")
+			} else {
+				fmt.Fprintf(&out, "%s|--> %s%s\n", prefix, gate, label(d))
+				draw(d, prefix+"|     ")
+			}
+		}
+	}
+
+	for i, root := range l.Roots() {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "%s\n", label(root))
+		draw(root, "  ")
+	}
+	return out.String()
+}
+
+func (c Config) dot(l *Layout) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "digraph %q {\n", c.Name)
+	fmt.Fprintf(&out, "  rankdir=LR;\n")
+	fmt.Fprintf(&out, "  node [shape=box];\n\n")
+	for _, name := range l.Envs {
+		style := "dashed"
+		if l.Automatic(name) {
+			style = "bold"
+		}
+		label := append([]string{name}, c.notes(l, name)...)
+		fmt.Fprintf(&out, "  %q [label=%q, style=%s];\n", name, strings.Join(label, "\n"), style)
+	}
+	if len(l.Edges) > 0 {
+		out.WriteString("\n")
+	}
+	for _, e := range l.Edges {
+		if e.Approve {
+			fmt.Fprintf(&out, "  %q -> %q [label=\"approve\", style=dashed];\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(&out, "  %q -> %q;\n", e.From, e.To)
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func (c Config) mermaid(l *Layout) string {
+	id := make(map[string]string)
+	for i, name := range l.Envs {
+		id[name] = fmt.Sprintf("env%d", i+1)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("graph LR\n")
+	auto := make([]string, 0)
+	for _, name := range l.Envs {
+		label := append([]string{name}, c.notes(l, name)...)
+		fmt.Fprintf(&out, "  %s[\"%s\"]\n", id[name], strings.Join(label, "<br/>"))
+		if l.Automatic(name) {
+			auto = append(auto, id[name])
+		}
+	}
+	for _, e := range l.Edges {
+		if e.Approve {
+			fmt.Fprintf(&out, "  %s -->|approve| %s\n", id[e.From], id[e.To])
+		} else {
+			fmt.Fprintf(&out, "  %s --> %s\n", id[e.From], id[e.To])
+		}
+	}
+	if len(auto) > 0 {
+		out.WriteString("  classDef auto stroke-width:3px\n")
+		fmt.Fprintf(&out, "  class %s auto\n", strings.Join(auto, ","))
+	}
+	return out.String()
+}
+
+func (c Config) ascii(l *Layout) string {
+	return l.Tree(func(name string) string {
+		return fmt.Sprintf("%s (%s)", name, strings.Join(c.notes(l, name), ", "))
+	})
+}
+
+// Draw a layout, as Graphviz DOT, a Mermaid flowchart, or ASCII art.
+// Environments are marked as either auto(matically) or manual(ly)
+// triggered, with their deployment window (if any), the BOSH director
+// they deploy to, and the smoke test (if any) that runs after each
+// deployment.  Gated links are labeled `approve`.
+func (c Config) Graph(l *Layout, format string) (string, error) {
+	switch format {
+	case DOT:
+		return c.dot(l), nil
+	case Mermaid:
+		return c.mermaid(l), nil
+	case ASCII:
+		return c.ascii(l), nil
+	}
+	return "", fmt.Errorf("unrecognized graph format '%s' (must be one of %s)", format, strings.Join(GraphFormats, ", "))
+}
@@ -0,0 +1,414 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An Error is a problem with a pipeline layout, at a specific place in
+// its source.
+type Error struct {
+	Pos     Pos
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// LayoutError collects all of the problems found with a single layout.
+type LayoutError struct {
+	Layout string
+	Errors []Error
+}
+
+func (e LayoutError) Error() string {
+	l := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		l[i] = err.Error()
+	}
+	return fmt.Sprintf("pipeline layout '%s' has problems:\n  - %s", e.Layout, strings.Join(l, "\n  - "))
+}
+
+// An Edge in the pipeline DAG; deploying From (successfully) triggers
+// (or at least, allows) a deploy of To.
+type Edge struct {
+	From    string
+	To      string
+	Approve bool // does someone have to approve it first?  (`a -> [approve] -> b`)
+	Pos     Pos  // where To appears in the layout source
+}
+
+// A Glob names the environments that deploy automatically, i.e.
+// `*-sandbox`, from an `auto` statement.
+type Glob struct {
+	Pattern string
+	Pos     Pos
+}
+
+// A Layout is a parsed pipeline layout, like
+//
+//	auto *sandbox *preprod
+//	us-east-1-sandbox -> us-east-1-preprod -> us-east-1-prod
+//	us-west-1-sandbox -> us-west-1-preprod ; us-west-1-preprod -> us-west-1-prod
+//
+// Each line is either an `auto` statement (listing the environments that
+// should be deployed without human intervention, as shell globs), or a
+// set of `;`-separated chains of environments, linked by `->`.  A chain
+// can be a single environment, for ones that nothing depends on.
+//
+// Links can be gated, so that someone has to approve each deploy across
+// them (`us-east-1-preprod -> [approve] -> us-east-1-prod`), and any
+// environment can be given a deployment window, outside of which it will
+// not be deployed (`us-east-1-prod@weekdays 02:00-05:00`; see Window).
+type Layout struct {
+	Name    string
+	Auto    []Glob
+	Envs    []string // in order of first appearance
+	Edges   []Edge
+	Windows map[string]Window
+
+	pos map[string]Pos // where each environment first appears
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	layout *Layout
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.typ != tEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, Error{Pos: t.pos, Message: fmt.Sprintf("expected %s, but found %s", typ, t)}
+	}
+	return t, nil
+}
+
+func (p *parser) env(t token) {
+	if _, seen := p.layout.pos[t.value]; !seen {
+		p.layout.pos[t.value] = t.pos
+		p.layout.Envs = append(p.layout.Envs, t.value)
+	}
+}
+
+// auto GLOB...
+func (p *parser) auto() error {
+	n := 0
+	for p.peek().typ == tName {
+		t := p.next()
+		if _, err := gopath.Match(t.value, ""); err != nil {
+			return Error{Pos: t.pos, Message: fmt.Sprintf("bad auto pattern '%s': %s", t.value, err)}
+		}
+		p.layout.Auto = append(p.layout.Auto, Glob{Pattern: t.value, Pos: t.pos})
+		n++
+	}
+	if n == 0 {
+		t := p.peek()
+		return Error{Pos: t.pos, Message: fmt.Sprintf("expected an environment pattern after 'auto', but found %s", t)}
+	}
+	return nil
+}
+
+// ENV[@WINDOW]
+func (p *parser) target() (token, error) {
+	t, err := p.expect(tName)
+	if err != nil {
+		return t, err
+	}
+	p.env(t)
+
+	if p.peek().typ == tWindow {
+		at := p.next()
+		w, err := parseWindow(at.value, at.pos)
+		if err != nil {
+			return t, err
+		}
+		if first, seen := p.layout.Windows[t.value]; seen && first.Spec != w.Spec {
+			return t, Error{Pos: w.Pos, Message: fmt.Sprintf("environment '%s' already has a deployment window (@%s, at %s)", t.value, first.Spec, first.Pos)}
+		}
+		p.layout.Windows[t.value] = w
+	}
+	return t, nil
+}
+
+// ENV [-> [[approve] ->] ENV]...
+func (p *parser) chain() error {
+	from, err := p.target()
+	if err != nil {
+		return err
+	}
+
+	for p.peek().typ == tArrow {
+		p.next()
+		approve := false
+		if p.peek().typ == tGate {
+			gate := p.next()
+			if gate.value != "approve" {
+				return Error{Pos: gate.pos, Message: fmt.Sprintf("unknown gate %s (the only gate is '[approve]')", gate)}
+			}
+			if _, err := p.expect(tArrow); err != nil {
+				return err
+			}
+			approve = true
+		}
+		to, err := p.target()
+		if err != nil {
+			return err
+		}
+		p.layout.Edges = append(p.layout.Edges, Edge{From: from.value, To: to.value, Approve: approve, Pos: to.pos})
+		from = to
+	}
+	return nil
+}
+
+func (p *parser) statement() error {
+	if t := p.peek(); t.typ == tName && t.value == "auto" {
+		p.next()
+		if err := p.auto(); err != nil {
+			return err
+		}
+
+	} else {
+		if err := p.chain(); err != nil {
+			return err
+		}
+		for p.peek().typ == tSemicolon {
+			p.next()
+			if err := p.chain(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if t := p.peek(); t.typ != tEOF {
+		if _, err := p.expect(tNewline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse the source of a pipeline layout into a DAG of environments.
+// Syntax errors stop the parse; after that, all duplicate edges and
+// cycles are found and returned together, as a LayoutError.
+func Parse(name, src string) (*Layout, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, LayoutError{Layout: name, Errors: []Error{err.(Error)}}
+	}
+
+	p := &parser{
+		tokens: tokens,
+		layout: &Layout{
+			Name:    name,
+			Windows: make(map[string]Window),
+			pos:     make(map[string]Pos),
+		},
+	}
+	for p.peek().typ != tEOF {
+		if p.peek().typ == tNewline {
+			p.next()
+			continue
+		}
+		if err := p.statement(); err != nil {
+			return nil, LayoutError{Layout: name, Errors: []Error{err.(Error)}}
+		}
+	}
+	if len(p.layout.Envs) == 0 {
+		return nil, LayoutError{Layout: name, Errors: []Error{{Pos: Pos{Line: 1, Column: 1}, Message: "no environments are defined"}}}
+	}
+
+	errs := append(p.layout.duplicates(), p.layout.cycles()...)
+	if len(errs) > 0 {
+		return nil, LayoutError{Layout: name, Errors: errs}
+	}
+	return p.layout, nil
+}
+
+func (l *Layout) duplicates() []Error {
+	errs := make([]Error, 0)
+	seen := make(map[string]Edge)
+	for _, e := range l.Edges {
+		k := e.From + " -> " + e.To
+		if first, dupe := seen[k]; dupe {
+			errs = append(errs, Error{Pos: e.Pos, Message: fmt.Sprintf("duplicate edge %s (first seen at %s)", k, first.Pos)})
+			continue
+		}
+		seen[k] = e
+	}
+	return errs
+}
+
+// Find every edge that closes a cycle, via a depth-first search from
+// each environment, in order.
+func (l *Layout) cycles() []Error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	errs := make([]Error, 0)
+	state := make(map[string]int)
+	stack := make([]string, 0)
+	reported := make(map[Edge]bool)
+
+	var visit func(string)
+	visit = func(env string) {
+		state[env] = visiting
+		stack = append(stack, env)
+		for _, e := range l.Edges {
+			if e.From != env {
+				continue
+			}
+			switch state[e.To] {
+			case unvisited:
+				visit(e.To)
+			case visiting:
+				if reported[e] {
+					continue
+				}
+				reported[e] = true
+				i := len(stack) - 1
+				for stack[i] != e.To {
+					i--
+				}
+				loop := append(append([]string{}, stack[i:]...), e.To)
+				errs = append(errs, Error{Pos: e.Pos, Message: fmt.Sprintf("cycle detected: %s", strings.Join(loop, " -> "))})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[env] = visited
+	}
+
+	for _, env := range l.Envs {
+		if state[env] == unvisited {
+			visit(env)
+		}
+	}
+	return errs
+}
+
+// Check a layout against the deployments repo that it lives in: every
+// environment needs an environment file in root (i.e. `us-east-1-prod.yml`)
+// and a BOSH director, from the `boshes:` section of the pipeline config.
+func (l *Layout) Check(root string, boshes []string) error {
+	director := make(map[string]bool)
+	for _, name := range boshes {
+		director[name] = true
+	}
+
+	errs := make([]Error, 0)
+	for _, env := range l.Envs {
+		if _, err := os.Stat(filepath.Join(root, env+".yml")); err != nil {
+			errs = append(errs, Error{Pos: l.pos[env], Message: fmt.Sprintf("unknown environment '%s' (there is no %s.yml)", env, env)})
+		}
+		if !director[env] {
+			errs = append(errs, Error{Pos: l.pos[env], Message: fmt.Sprintf("environment '%s' has no BOSH director (in boshes:)", env)})
+		}
+	}
+	if len(errs) > 0 {
+		return LayoutError{Layout: l.Name, Errors: errs}
+	}
+	return nil
+}
+
+// Is this environment deployed automatically, when its upstream changes?
+func (l *Layout) Automatic(env string) bool {
+	for _, g := range l.Auto {
+		if ok, _ := gopath.Match(g.Pattern, env); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Does someone have to approve deploys of env, after from?
+func (l *Layout) Gated(from, env string) bool {
+	for _, e := range l.Edges {
+		if e.From == from && e.To == env && e.Approve {
+			return true
+		}
+	}
+	return false
+}
+
+// The environments that must be deployed before this one, sorted.
+func (l *Layout) Upstream(env string) []string {
+	s := make([]string, 0)
+	for _, e := range l.Edges {
+		if e.To == env {
+			s = append(s, e.From)
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+// The environments that are deployed after this one, sorted.
+func (l *Layout) Downstream(env string) []string {
+	s := make([]string, 0)
+	for _, e := range l.Edges {
+		if e.From == env {
+			s = append(s, e.To)
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+// The environments with nothing upstream of them, in layout order.
+func (l *Layout) Roots() []string {
+	s := make([]string, 0)
+	for _, env := range l.Envs {
+		if len(l.Upstream(env)) == 0 {
+			s = append(s, env)
+		}
+	}
+	return s
+}
+
+// All environments, in an order where every environment comes after
+// everything upstream of it (ties are broken by layout order).
+func (l *Layout) Sorted() []string {
+	pending := make(map[string]int)
+	for _, e := range l.Edges {
+		pending[e.To]++
+	}
+
+	s := make([]string, 0, len(l.Envs))
+	done := make(map[string]bool)
+	for len(s) < len(l.Envs) {
+		for _, env := range l.Envs {
+			if done[env] || pending[env] > 0 {
+				continue
+			}
+			done[env] = true
+			s = append(s, env)
+			for _, e := range l.Edges {
+				if e.From == env {
+					pending[e.To]--
+				}
+			}
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tNewline
+	tName
+	tArrow
+	tSemicolon
+	tGate   // [approve]
+	tWindow // @weekdays 02:00-05:00
+)
+
+func (t tokenType) String() string {
+	switch t {
+	case tEOF:
+		return "end of layout"
+	case tNewline:
+		return "end of line"
+	case tArrow:
+		return "'->'"
+	case tSemicolon:
+		return "';'"
+	case tGate:
+		return "gate"
+	case tWindow:
+		return "deployment window"
+	}
+	return "environment name"
+}
+
+// A Pos is a position in the source of a layout; both Line and Column
+// start counting at 1.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   Pos
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tName:
+		return fmt.Sprintf("'%s'", t.value)
+	case tGate:
+		return fmt.Sprintf("'[%s]'", t.value)
+	case tWindow:
+		return fmt.Sprintf("'@%s'", t.value)
+	}
+	return t.typ.String()
+}
+
+// Anything that isn't whitespace, punctuation (`;`, `@`, `[` or `]`) or
+// the start of a comment can be part of an environment name (or an auto
+// glob), but `->` always ends one, so that `a->b` works just like `a -> b`.
+func name(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(";@[]#", r)
+}
+
+// Where the token that starts at runes[i] ends: at the next `->`, or
+// any of the given characters.
+func until(runes []rune, i int, stop string) int {
+	for ; i < len(runes); i++ {
+		if strings.ContainsRune(stop, runes[i]) {
+			break
+		}
+		if runes[i] == '-' && i+1 < len(runes) && runes[i+1] == '>' {
+			break
+		}
+	}
+	return i
+}
+
+// Split the source of a layout into tokens.  Comments run from a `#`
+// to the end of the line, and are thrown away, along with all other
+// whitespace (except for newlines, which end statements).
+func lex(src string) ([]token, error) {
+	l := make([]token, 0)
+	for n, line := range strings.Split(src, "\n") {
+		runes := []rune(line)
+		for i := 0; i < len(runes); {
+			pos := Pos{Line: n + 1, Column: i + 1}
+			r := runes[i]
+
+			switch {
+			case r == '#':
+				i = len(runes)
+
+			case unicode.IsSpace(r):
+				i++
+
+			case r == ';':
+				l = append(l, token{typ: tSemicolon, value: ";", pos: pos})
+				i++
+
+			case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+				l = append(l, token{typ: tArrow, value: "->", pos: pos})
+				i += 2
+
+			case r == '>':
+				return nil, Error{Pos: pos, Message: "unexpected '>' (did you mean '->'?)"}
+
+			case r == ']':
+				return nil, Error{Pos: pos, Message: "unexpected ']' (gates look like '[approve]')"}
+
+			case r == '[':
+				j := i + 1
+				for j < len(runes) && runes[j] != ']' {
+					j++
+				}
+				if j == len(runes) {
+					return nil, Error{Pos: pos, Message: "unterminated gate (missing ']')"}
+				}
+				l = append(l, token{typ: tGate, value: strings.TrimSpace(string(runes[i+1 : j])), pos: pos})
+				i = j + 1
+
+			case r == '@':
+				// windows have spaces in them, so they run all the way to
+				// the next arrow, semicolon, comment, or end of the line
+				j := until(runes, i+1, ";#")
+				l = append(l, token{typ: tWindow, value: strings.TrimSpace(string(runes[i+1 : j])), pos: pos})
+				i = j
+
+			default:
+				j := i
+				for j < len(runes) && name(runes[j]) {
+					if runes[j] == '-' && j+1 < len(runes) && runes[j+1] == '>' {
+						break
+					}
+					j++
+				}
+				l = append(l, token{typ: tName, value: string(runes[i:j]), pos: pos})
+				i = j
+			}
+		}
+		l = append(l, token{typ: tNewline, pos: Pos{Line: n + 1, Column: len(runes) + 1}})
+	}
+	return append(l, token{typ: tEOF, pos: l[len(l)-1].pos}), nil
+}
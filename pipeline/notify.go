@@ -0,0 +1,257 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Events that notifications can be sent for.
+const (
+	Success = "success"
+	Failure = "failure"
+	Pending = "pending-approval" // an upstream deploy worked; this one needs a human
+)
+
+var Events = []string{Success, Failure, Pending}
+
+// Kinds of notifications.
+const (
+	Slack   = "slack"
+	Webhook = "webhook"
+	Email   = "email"
+	Teams   = "teams"
+)
+
+var Notifiers = []string{Slack, Webhook, Email, Teams}
+
+// A Notification sink, from the `notifications:` list in the pipeline
+// configuration, i.e.
+//
+//	notifications:
+//	  - type:    slack
+//	    channel: '#ops'
+//	    webhook: https://hooks.slack.com/services/...
+//	    events:  [failure, pending-approval]
+//
+//	  - type: webhook
+//	    url:  https://status.example.com/deploys
+//	    body: '{"env":"{{.Env}}","event":"{{.Event}}"}'
+//
+//	  - type: email
+//	    smtp: { host: smtp.example.com, port: 587, username: ci, password: sekrit }
+//	    from: ci@example.com
+//	    to:   [ops@example.com]
+//
+//	  - type:    teams
+//	    webhook: https://outlook.office.com/webhook/...
+//
+// Sinks get all events, unless they list the ones they want.  Webhook
+// bodies are Go templates, with .Pipeline, .Env, .Event and .Message
+// available; by default, they get all four, as a JSON object.
+type Notification struct {
+	Name   string   `yaml:"name"`
+	Type   string   `yaml:"type"`
+	Events []string `yaml:"events"`
+
+	Channel string `yaml:"channel"` // slack
+	Webhook string `yaml:"webhook"` // slack and teams
+
+	URL  string `yaml:"url"`  // webhook
+	Body string `yaml:"body"` // webhook
+
+	SMTP struct {
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"smtp"` // email
+	From string   `yaml:"from"` // email
+	To   []string `yaml:"to"`   // email
+
+	body *template.Template
+}
+
+func among(s string, l []string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Check a notification, filling in its defaults; i is its position in
+// the list (starting at 1), for naming it and for error messages.
+func (n *Notification) check(i int) error {
+	if !among(n.Type, Notifiers) {
+		return fmt.Errorf("notification #%d has an unrecognized type '%s' (must be one of %s)", i, n.Type, strings.Join(Notifiers, ", "))
+	}
+	if n.Name == "" {
+		n.Name = fmt.Sprintf("%s-%d", n.Type, i)
+	}
+	if len(n.Events) == 0 {
+		n.Events = Events
+	}
+	for _, e := range n.Events {
+		if !among(e, Events) {
+			return fmt.Errorf("notification %s has an unrecognized event '%s' (must be one of %s)", n.Name, e, strings.Join(Events, ", "))
+		}
+	}
+
+	var missing string
+	switch n.Type {
+	case Slack, Teams:
+		if n.Webhook == "" {
+			missing = "webhook"
+		}
+	case Webhook:
+		if n.URL == "" {
+			missing = "url"
+		}
+		if n.Body == "" {
+			n.Body = `{"pipeline":{{json .Pipeline}},"env":{{json .Env}},"event":{{json .Event}},"message":{{json .Message}}}`
+		}
+		t, err := template.New(n.Name).Funcs(template.FuncMap{"json": quote}).Parse(n.Body)
+		if err == nil {
+			err = t.Execute(&bytes.Buffer{}, payload{})
+		}
+		if err != nil {
+			return fmt.Errorf("notification %s has a bad body template: %s", n.Name, err)
+		}
+		n.body = t
+	case Email:
+		if n.SMTP.Host == "" {
+			missing = "smtp.host"
+		} else if n.From == "" {
+			missing = "from"
+		} else if len(n.To) == 0 {
+			missing = "to"
+		}
+		if n.SMTP.Port == 0 {
+			n.SMTP.Port = 25
+		}
+	}
+	if missing != "" {
+		return fmt.Errorf("notification %s (%s) is missing its %s", n.Name, n.Type, missing)
+	}
+	return nil
+}
+
+// What webhook body templates have to work with.
+type payload struct {
+	Pipeline string
+	Env      string
+	Event    string
+	Message  string
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (n Notification) wants(event string) bool {
+	return among(event, n.Events)
+}
+
+func (n Notification) resource() string {
+	return "notify-" + n.Name
+}
+
+func message(pipeline, env, event string) string {
+	switch event {
+	case Success:
+		return fmt.Sprintf("%s deployed successfully (pipeline %s)", env, pipeline)
+	case Failure:
+		return fmt.Sprintf("%s failed to deploy (pipeline %s)", env, pipeline)
+	}
+	return fmt.Sprintf("%s is ready to deploy, pending approval (pipeline %s)", env, pipeline)
+}
+
+// The Concourse resource (if any) that a notification is sent through.
+func (c Config) notifier(n Notification) (Resource, bool) {
+	r := Resource{Name: n.resource()}
+	switch n.Type {
+	case Slack:
+		r.Type = "slack-notification"
+		r.Source = map[string]interface{}{"url": c.secret(r.Name+"-webhook", n.Webhook)}
+	case Teams:
+		r.Type = "teams-notification"
+		r.Source = map[string]interface{}{"url": c.secret(r.Name+"-webhook", n.Webhook)}
+	case Email:
+		r.Type = "email"
+		r.Source = map[string]interface{}{
+			"smtp": map[string]interface{}{
+				"host":     n.SMTP.Host,
+				"port":     fmt.Sprintf("%d", n.SMTP.Port),
+				"username": n.SMTP.Username,
+				"password": c.secret(r.Name+"-password", n.SMTP.Password),
+			},
+			"from": n.From,
+			"to":   n.To,
+		}
+	default:
+		return r, false
+	}
+	return r, true
+}
+
+// The step that sends a notification about an event for an environment.
+func (c Config) notify(n Notification, name, event string) Step {
+	msg := message(c.Name, name, event)
+	switch n.Type {
+	case Slack:
+		return Step{Put: n.resource(), Params: map[string]interface{}{
+			"channel": n.Channel,
+			"text":    msg,
+		}}
+	case Teams:
+		return Step{Put: n.resource(), Params: map[string]interface{}{
+			"title": c.Name,
+			"text":  msg,
+		}}
+	case Email:
+		return Step{Put: n.resource(), Params: map[string]interface{}{
+			"subject_text": fmt.Sprintf("[%s] %s %s", c.Name, name, event),
+			"body_text":    msg,
+		}}
+	}
+
+	var body bytes.Buffer
+	n.body.Execute(&body, payload{Pipeline: c.Name, Env: name, Event: event, Message: msg})
+	t := c.task("sh", []string{"-c", `curl -sSf -X POST -H 'Content-Type: application/json' -d "$BODY" "$URL"`})
+	t.Params = map[string]interface{}{
+		"URL":  c.secret(n.resource()+"-url", n.URL),
+		"BODY": body.String(),
+	}
+	return Step{Task: n.resource(), Config: t, Tags: c.tags(name)}
+}
+
+// Something that happened to an environment.
+type event struct {
+	env  string
+	kind string
+}
+
+// All the notifications to send, in one step, for a set of events;
+// nil if nobody wants to hear about any of them.
+func (c Config) notifications(events ...event) *Step {
+	steps := make([]Step, 0)
+	for _, e := range events {
+		for _, n := range c.Notifications {
+			if n.wants(e.kind) {
+				steps = append(steps, c.notify(n, e.env, e.kind))
+			}
+		}
+	}
+	switch len(steps) {
+	case 0:
+		return nil
+	case 1:
+		return &steps[0]
+	}
+	return &Step{Aggregate: steps}
+}
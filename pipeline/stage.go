@@ -0,0 +1,254 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhunt/genesis/bosh"
+	"github.com/jhunt/genesis/env"
+)
+
+// A Stage of a pipeline job, as run (by `genesis ci pipeline ...`) from
+// inside a Concourse task.  Everything comes from the task's params (see
+// Config.job); VAULT_* are left in the environment, for safe and spruce,
+// and GIT_PRIVATE_KEY is only needed by the `put: git` that pushes.
+type Stage struct {
+	Env        string // CURRENT_ENV
+	WorkingDir string // WORKING_DIR, where the `put: git` that follows looks for commits
+	Branch     string // GIT_BRANCH
+	BoshConfig string // BOSH_CONFIG, the contents of a BOSH CLI config file
+	BoshTarget string // BOSH_TARGET, the director's alias in BoshConfig
+	Errand     string // ERRAND_NAME, for smoke tests
+	Window     string // DEPLOY_WINDOW, outside of which stage1 won't deploy
+}
+
+func StageFromEnvironment() (Stage, error) {
+	s := Stage{
+		Env:        os.Getenv("CURRENT_ENV"),
+		WorkingDir: os.Getenv("WORKING_DIR"),
+		Branch:     os.Getenv("GIT_BRANCH"),
+		BoshConfig: os.Getenv("BOSH_CONFIG"),
+		BoshTarget: os.Getenv("BOSH_TARGET"),
+		Errand:     os.Getenv("ERRAND_NAME"),
+		Window:     os.Getenv("DEPLOY_WINDOW"),
+	}
+	if s.Env == "" {
+		return s, fmt.Errorf("CURRENT_ENV is not set (is this running in a Concourse pipeline?)")
+	}
+	if s.Branch == "" {
+		s.Branch = DefaultBranch
+	}
+	if s.WorkingDir != "" {
+		dir, err := filepath.Abs(s.WorkingDir)
+		if err != nil {
+			return s, err
+		}
+		s.WorkingDir = dir
+	}
+	return s, nil
+}
+
+// run a git command in a working copy; its output goes to our standard
+// error, to keep it out of the way of anything else.
+func git(dir string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("`git %s` failed: %s", args[0], msg)
+	}
+	os.Stderr.Write(stderr.Bytes())
+	return nil
+}
+
+func origin(dir string) string {
+	b, err := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Checkouts in a pipeline aren't named after the deployments repo (i.e.
+// `code` or `out/git`), so we go by where they were cloned from.
+func identify(root string) {
+	if os.Getenv("GENESIS_TYPE") != "" {
+		return
+	}
+	if url := origin(root); url != "" {
+		name := strings.TrimSuffix(filepath.Base(url), ".git")
+		os.Setenv("GENESIS_TYPE", strings.TrimSuffix(name, "-deployments"))
+	}
+}
+
+// Make the BOSH CLI use our BOSH_CONFIG, which is given to us as YAML,
+// rather than as a path.  The returned func cleans up after it.
+func (s Stage) bosh() (func(), error) {
+	if s.BoshConfig == "" {
+		return func() {}, nil
+	}
+	f, err := ioutil.TempFile("", "genesis-bosh-config-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(s.BoshConfig); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	f.Close()
+	os.Setenv("BOSH_CONFIG", f.Name())
+	return func() { os.Remove(f.Name()) }, nil
+}
+
+// Get the working directory ready, as a clone of the deployments repo
+// at root (looking like it came from wherever root did), or by rebasing
+// it onto root, if it's already there; all work happens in there.
+func (s Stage) checkout(root string) (env.Env, error) {
+	if s.WorkingDir == "" {
+		return env.Env{}, fmt.Errorf("WORKING_DIR is not set (is this running in a Concourse pipeline?)")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return env.Env{}, err
+	}
+	identify(root)
+
+	if _, err := os.Stat(filepath.Join(s.WorkingDir, ".git")); err != nil {
+		if err := git(".", "clone", "--branch", s.Branch, root, s.WorkingDir); err != nil {
+			return env.Env{}, err
+		}
+		if url := origin(root); url != "" {
+			if err := git(s.WorkingDir, "remote", "set-url", "origin", url); err != nil {
+				return env.Env{}, err
+			}
+		}
+	} else if err := git(s.WorkingDir, "pull", "--rebase", root, s.Branch); err != nil {
+		return env.Env{}, err
+	}
+
+	// kits (in dev/ or .genesis/kits) are found relative to where we are
+	if err := os.Chdir(s.WorkingDir); err != nil {
+		return env.Env{}, err
+	}
+	return env.Load(".", s.Env)
+}
+
+// Copy the environment's hierarchy (all but its own file) into its
+// cached directory, for the environments downstream of it to pick up,
+// and commit that, along with the deployment ledger and manifest.
+func propagate(e env.Env) error {
+	if err := os.MkdirAll(e.CachedDir(), 0777); err != nil {
+		return err
+	}
+	for _, file := range e.Files() {
+		if file == e.File() {
+			continue
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(e.CachedDir(), filepath.Base(file)), b, 0666); err != nil {
+			return err
+		}
+	}
+
+	if err := git(".", "add", "--all", e.CachedDir()); err != nil {
+		return err
+	}
+	if exec.Command("git", "diff", "--cached", "--quiet").Run() == nil {
+		fmt.Fprintf(os.Stderr, "nothing to propagate from %s\n", e.Name)
+		return nil
+	}
+
+	args := []string{"commit", "-m", fmt.Sprintf("deployed %s", e.Name)}
+	if exec.Command("git", "config", "user.email").Run() != nil {
+		args = append([]string{"-c", "user.name=Concourse", "-c", "user.email=concourse@localhost"}, args...)
+	}
+	return git(".", args...)
+}
+
+// Stage 1: deploy the environment (recording the outcome in its ledger)
+// and, if that works, go on to stage 2.  Environments with a deployment
+// window are not deployed outside of it, however the job was triggered.
+func (s Stage) Stage1(root string) error {
+	if s.Window != "" {
+		w, err := ParseWindow(s.Window)
+		if err != nil {
+			return fmt.Errorf("DEPLOY_WINDOW: %s", err)
+		}
+		if now := time.Now(); !w.Contains(now) {
+			return fmt.Errorf("not deploying %s outside of its deployment window (%s); it is %s", s.Env, w.Spec, now.UTC().Format("Mon 15:04 MST"))
+		}
+	}
+
+	e, err := s.checkout(root)
+	if err != nil {
+		return err
+	}
+	k, err := e.Kit()
+	if err != nil {
+		return err
+	}
+
+	done, err := s.bosh()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := e.Deploy(k, env.DeployOptions{Director: s.BoshTarget}); err != nil {
+		return err
+	}
+	return propagate(e)
+}
+
+// Stage 2: propagate the (already deployed) environment's files to the
+// environments downstream of it, via a commit in the working directory.
+func (s Stage) Stage2(root string) error {
+	e, err := s.checkout(root)
+	if err != nil {
+		return err
+	}
+	return propagate(e)
+}
+
+// Run the smoke test errand against the environment's deployment, from
+// the deployments repo at root.
+func (s Stage) SmokeTest(root string) error {
+	if s.Errand == "" {
+		return fmt.Errorf("ERRAND_NAME is not set (is this running in a Concourse pipeline?)")
+	}
+	identify(root)
+	e, err := env.Load(root, s.Env)
+	if err != nil {
+		return err
+	}
+
+	done, err := s.bosh()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	alias := s.BoshTarget
+	if alias == "" {
+		if alias, err = e.Director(); err != nil {
+			return err
+		}
+	}
+	return bosh.Director{Environment: alias}.RunErrand(e.Deployment(), s.Errand)
+}
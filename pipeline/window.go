@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Window of time that an environment can be deployed in, from the
+// layout (i.e. `us-east-1-prod@weekdays 02:00-05:00`).  Windows are made
+// up of the days (`weekdays`, `weekends`, `daily`, or a list like
+// `mon,wed,fri` or `mon-thu`), the times (24-hour), and optionally, the
+// time zone they're in (i.e. `America/New_York`; UTC by default).
+type Window struct {
+	Spec     string   // as given in the layout (but tidied up)
+	Days     []string // empty for every day
+	Start    string
+	Stop     string
+	Location string
+	Pos      Pos
+}
+
+var weekdays = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+func day(s string) (int, bool) {
+	s = strings.ToLower(s)
+	for i, d := range weekdays {
+		if len(s) >= 3 && strings.HasPrefix(strings.ToLower(d), s) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func days(s string) ([]string, error) {
+	switch strings.ToLower(s) {
+	case "daily", "everyday":
+		return nil, nil
+	case "weekdays":
+		return weekdays[1:6], nil
+	case "weekends":
+		return []string{weekdays[6], weekdays[0]}, nil
+	}
+
+	l := make([]string, 0)
+	for _, part := range strings.Split(s, ",") {
+		ends := strings.SplitN(part, "-", 2)
+		from, ok := day(ends[0])
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a day of the week", ends[0])
+		}
+		to := from
+		if len(ends) == 2 {
+			if to, ok = day(ends[1]); !ok {
+				return nil, fmt.Errorf("'%s' is not a day of the week", ends[1])
+			}
+		}
+		for i := from; ; i = (i + 1) % 7 {
+			l = append(l, weekdays[i])
+			if i == to {
+				break
+			}
+		}
+	}
+	return l, nil
+}
+
+func parseWindow(spec string, pos Pos) (Window, error) {
+	fields := strings.Fields(spec)
+	w := Window{Spec: strings.Join(fields, " "), Pos: pos}
+
+	bad := func(format string, args ...interface{}) (Window, error) {
+		return w, Error{Pos: pos, Message: fmt.Sprintf("bad deployment window '@%s': ", w.Spec) + fmt.Sprintf(format, args...)}
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return bad("expected DAYS HH:MM-HH:MM [TIMEZONE]")
+	}
+
+	var err error
+	if w.Days, err = days(fields[0]); err != nil {
+		return bad("%s", err)
+	}
+
+	times := strings.SplitN(fields[1], "-", 2)
+	if len(times) != 2 {
+		return bad("expected a time range, like 02:00-05:00")
+	}
+	for _, t := range times {
+		if _, err := time.Parse("15:04", t); err != nil {
+			return bad("'%s' is not a (24-hour) time of day", t)
+		}
+	}
+	w.Start, w.Stop = times[0], times[1]
+
+	if len(fields) == 3 {
+		if _, err := time.LoadLocation(fields[2]); err != nil {
+			return bad("unknown time zone '%s'", fields[2])
+		}
+		w.Location = fields[2]
+	}
+	return w, nil
+}
+
+// Parse a deployment window on its own (i.e. from $DEPLOY_WINDOW), as it
+// would be given in a layout, after the `@`.
+func ParseWindow(spec string) (Window, error) {
+	w, err := parseWindow(spec, Pos{})
+	if e, ok := err.(Error); ok {
+		return w, fmt.Errorf("%s", e.Message)
+	}
+	return w, err
+}
+
+// Whether or not a time falls inside of the window.  Windows that stop
+// before they start run overnight, and count as being on the day that
+// they started.
+func (w Window) Contains(t time.Time) bool {
+	loc := time.UTC
+	if w.Location != "" {
+		if l, err := time.LoadLocation(w.Location); err == nil {
+			loc = l
+		}
+	}
+	t = t.In(loc)
+
+	minutes := func(s string) int {
+		hm, _ := time.Parse("15:04", s)
+		return hm.Hour()*60 + hm.Minute()
+	}
+	now, start, stop := t.Hour()*60+t.Minute(), minutes(w.Start), minutes(w.Stop)
+
+	today := t.Weekday()
+	switch {
+	case start <= stop:
+		if now < start || now >= stop {
+			return false
+		}
+	case now >= start:
+	case now < stop:
+		today = (today + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == weekdays[today] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jhunt/genesis/diff"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	File = "policy.yml"
+
+	Error   = "error"
+	Warning = "warning"
+)
+
+// A Rule, from policy.yml at the top of the deployments repo, i.e.
+//
+//	rules:
+//	  - id:          PROD-001
+//	    description: Production jobs must have more than one instance
+//	    envs:        ['*-prod']
+//	    path:        instance_groups.*.instances
+//	    min:         2
+//
+// Rules either apply to every value at a Path (which can contain shell
+// wildcards in any of its components), or to every scalar value under
+// a map key that matches Key (i.e. `*password*`, case-insensitively).
+// If Required is set, the last component of Path must be present in
+// every map that the rest of it matches.  Rules apply to all
+// environments, unless Envs (a list of environment name globs) says
+// otherwise.  Violating a rule with a Severity of "warning" doesn't
+// stop anything from being deployed.
+type Rule struct {
+	ID          string   `yaml:"id"`
+	Description string   `yaml:"description"`
+	Severity    string   `yaml:"severity"`
+	Envs        []string `yaml:"envs"`
+
+	Path     string `yaml:"path"`
+	Key      string `yaml:"key"`
+	Required bool   `yaml:"required"`
+
+	Min     *float64      `yaml:"min"`
+	Max     *float64      `yaml:"max"`
+	In      []interface{} `yaml:"in"`
+	NotIn   []interface{} `yaml:"not_in"`
+	Pattern string        `yaml:"pattern"`
+
+	re *regexp.Regexp
+}
+
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// A Violation of a Rule, at a specific path in a manifest.
+type Violation struct {
+	Rule    Rule
+	Path    string
+	Problem string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s: %s", v.Rule.ID, v.Path, v.Problem)
+}
+
+// A ViolationError lists all of the (non-warning) policy violations that
+// stand in the way of a deployment.
+type ViolationError struct {
+	Env        string
+	Violations []Violation
+}
+
+func (e ViolationError) Error() string {
+	l := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		l[i] = v.String()
+	}
+	return fmt.Sprintf("%s violates the following policy rules:\n  - %s", e.Env, strings.Join(l, "\n  - "))
+}
+
+// Load the policy rules in effect for a deployments repo.  Repos
+// without a policy.yml have no rules.
+func Load(root string) (Policy, error) {
+	var p Policy
+
+	file := filepath.Join(root, File)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return p, err
+	}
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("%s: %s", file, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, r := range p.Rules {
+		if r.ID == "" {
+			return p, fmt.Errorf("%s: rule #%d has no id", file, i+1)
+		}
+		if seen[r.ID] {
+			return p, fmt.Errorf("%s: rule %s is defined more than once", file, r.ID)
+		}
+		seen[r.ID] = true
+
+		if (r.Path == "") == (r.Key == "") {
+			return p, fmt.Errorf("%s: rule %s needs either a path or a key (but not both)", file, r.ID)
+		}
+		if r.Required && r.Path == "" {
+			return p, fmt.Errorf("%s: rule %s is required, but has no path", file, r.ID)
+		}
+		switch r.Severity {
+		case "":
+			p.Rules[i].Severity = Error
+		case Error, Warning:
+		default:
+			return p, fmt.Errorf("%s: rule %s has an unrecognized severity '%s' (must be one of %s, %s)",
+				file, r.ID, r.Severity, Error, Warning)
+		}
+		if r.Pattern != "" {
+			if p.Rules[i].re, err = regexp.Compile(r.Pattern); err != nil {
+				return p, fmt.Errorf("%s: rule %s has a bad pattern: %s", file, r.ID, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// Does this rule apply to the named environment?
+func (r Rule) Applies(env string) bool {
+	if len(r.Envs) == 0 {
+		return true
+	}
+	for _, glob := range r.Envs {
+		if ok, _ := gopath.Match(glob, env); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func among(v interface{}, l []interface{}) bool {
+	for _, x := range l {
+		if fmt.Sprintf("%v", x) == fmt.Sprintf("%v", v) {
+			return true
+		}
+	}
+	return false
+}
+
+func list(l []interface{}) string {
+	s := make([]string, len(l))
+	for i, x := range l {
+		s[i] = fmt.Sprintf("%v", x)
+	}
+	return strings.Join(s, ", ")
+}
+
+// check a single value against the rule, returning what's wrong with it
+func (r Rule) check(v interface{}) string {
+	if r.Min != nil || r.Max != nil {
+		n, ok := number(v)
+		if !ok {
+			return fmt.Sprintf("'%v' is not a number", v)
+		}
+		if r.Min != nil && n < *r.Min {
+			return fmt.Sprintf("%v is less than %v", v, *r.Min)
+		}
+		if r.Max != nil && n > *r.Max {
+			return fmt.Sprintf("%v is more than %v", v, *r.Max)
+		}
+	}
+	if r.In != nil && !among(v, r.In) {
+		return fmt.Sprintf("'%v' is not one of %s", v, list(r.In))
+	}
+	if r.NotIn != nil && among(v, r.NotIn) {
+		return fmt.Sprintf("'%v' is not allowed", v)
+	}
+	if r.re != nil && !r.re.MatchString(fmt.Sprintf("%v", v)) {
+		return fmt.Sprintf("'%v' does not match /%s/", v, r.Pattern)
+	}
+	return ""
+}
+
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case map[interface{}]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// Check a (redacted) manifest for the named environment against every
+// rule that applies to it, returning all violations, in rule order.
+func (p Policy) Check(env string, manifest []byte) ([]Violation, error) {
+	doc, err := diff.Parse(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]Violation, 0)
+	for _, r := range p.Rules {
+		if !r.Applies(env) {
+			continue
+		}
+
+		if r.Key != "" {
+			key := strings.ToLower(r.Key)
+			diff.Walk(doc, func(path string, v interface{}) {
+				if !scalar(v) {
+					return
+				}
+				for _, k := range strings.Split(path, ".") {
+					if ok, _ := gopath.Match(key, strings.ToLower(k)); ok {
+						if problem := r.check(v); problem != "" {
+							l = append(l, Violation{Rule: r, Path: path, Problem: problem})
+						}
+						return
+					}
+				}
+			})
+			continue
+		}
+
+		if r.Required {
+			parent, last := "", r.Path
+			if i := strings.LastIndex(r.Path, "."); i >= 0 {
+				parent, last = r.Path[:i], r.Path[i+1:]
+			}
+			diff.Walk(doc, func(path string, v interface{}) {
+				if m, ok := v.(map[interface{}]interface{}); ok && (path == parent || diff.Match(path, parent)) {
+					if _, found := m[last]; !found {
+						missing := last
+						if path != "" {
+							missing = path + "." + last
+						}
+						l = append(l, Violation{Rule: r, Path: missing, Problem: "is missing"})
+					}
+				}
+			})
+		}
+
+		diff.Walk(doc, func(path string, v interface{}) {
+			if diff.Match(path, r.Path) {
+				if problem := r.check(v); problem != "" {
+					l = append(l, Violation{Rule: r, Path: path, Problem: problem})
+				}
+			}
+		})
+	}
+	return l, nil
+}
+
+// Just the violations that should stop a deployment.
+func Errors(l []Violation) []Violation {
+	errs := make([]Violation, 0)
+	for _, v := range l {
+		if v.Rule.Severity != Warning {
+			errs = append(errs, v)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,173 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A Column of a report; Key is what users select it by (and what it is
+// called in JSON and CSV output), Header is what table output calls it.
+// Display, if set, turns a value into what is shown in a table.
+type Column struct {
+	Key     string
+	Header  string
+	Display func(v interface{}) string
+}
+
+// A Row of a report.  Rows with different Groups are separated by a
+// blank line in table output; rows are expected to be sorted by group.
+type Row struct {
+	Group  string
+	Values map[string]interface{}
+}
+
+type Report struct {
+	Columns []Column
+	Rows    []Row
+}
+
+var Formats = []string{"table", "json", "csv"}
+
+func (r Report) Render(format string, out io.Writer) error {
+	switch format {
+	case "", "table":
+		return r.Table(out)
+	case "json":
+		return r.JSON(out)
+	case "csv":
+		return r.CSV(out)
+	}
+	return fmt.Errorf("unrecognized output format '%s' (must be one of %s)", format, strings.Join(Formats, ", "))
+}
+
+func (r Report) display(c Column, v interface{}) string {
+	if c.Display != nil {
+		return c.Display(v)
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (r Report) Table(out io.Writer) error {
+	width := make([]int, len(r.Columns))
+	cells := make([][]string, len(r.Rows))
+	for i, c := range r.Columns {
+		width[i] = len(c.Header)
+	}
+	for j, row := range r.Rows {
+		cells[j] = make([]string, len(r.Columns))
+		for i, c := range r.Columns {
+			cells[j][i] = r.display(c, row.Values[c.Key])
+			if len(cells[j][i]) > width[i] {
+				width[i] = len(cells[j][i])
+			}
+		}
+	}
+
+	line := func(l []string) string {
+		s := ""
+		for i, v := range l {
+			s += fmt.Sprintf("%-*s", width[i]+4, v)
+		}
+		return strings.TrimRight(s, " ") + "\n"
+	}
+
+	headers := make([]string, len(r.Columns))
+	rules := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		headers[i] = c.Header
+		rules[i] = strings.Repeat("=", len(c.Header))
+	}
+	if _, err := io.WriteString(out, line(headers)+line(rules)); err != nil {
+		return err
+	}
+
+	for j, row := range r.Rows {
+		if j > 0 && row.Group != r.Rows[j-1].Group {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(out, line(cells[j])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Report) JSON(out io.Writer) error {
+	l := make([]map[string]interface{}, len(r.Rows))
+	for j, row := range r.Rows {
+		l[j] = make(map[string]interface{})
+		for _, c := range r.Columns {
+			l[j][c.Key] = row.Values[c.Key]
+		}
+	}
+
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
+
+func (r Report) CSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	headers := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		headers[i] = c.Key
+	}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+
+	for _, row := range r.Rows {
+		l := make([]string, len(r.Columns))
+		for i, c := range r.Columns {
+			switch v := row.Values[c.Key].(type) {
+			case nil:
+			case time.Time:
+				l[i] = v.Format(time.RFC3339)
+			case []string:
+				l[i] = strings.Join(v, " ")
+			default:
+				l[i] = fmt.Sprintf("%v", v)
+			}
+		}
+		if err := w.Write(l); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Select a subset of columns, by key, in the order given.
+func Select(all []Column, keys []string) ([]Column, error) {
+	l := make([]Column, 0, len(keys))
+	for _, key := range keys {
+		found := false
+		for _, c := range all {
+			if c.Key == key {
+				l = append(l, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			valid := make([]string, len(all))
+			for i, c := range all {
+				valid[i] = c.Key
+			}
+			return nil, fmt.Errorf("unrecognized column '%s' (must be one of %s)", key, strings.Join(valid, ", "))
+		}
+	}
+	return l, nil
+}
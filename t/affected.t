@@ -0,0 +1,164 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+ok -d "t/repos/affected-test", "affected-test repo exists" or die;
+
+qx(cp -R t/repos/affected-test $tmp/repo);
+chdir "$tmp/repo" or die;
+qx(git init -q && git symbolic-ref HEAD refs/heads/master && git add . &&
+   git -c user.name=test -c user.email=test\@example.com commit -q -m 'initial commit');
+
+sub commit {
+	qx(git add . && git -c user.name=test -c user.email=test\@example.com commit -q -m "$_[0]");
+}
+
+output_ok "genesis affected", <<EOF, "nothing is affected when nothing has changed";
+Environment    How    Because Of
+===========    ===    ==========
+EOF
+
+put_file "client-aws-1-sandbox.yml", get_file("client-aws-1-sandbox.yml")."  domain: sb.example.com\n";
+output_ok "genesis affected", <<EOF, "uncommitted changes affect an environment and everything downstream of it";
+Environment             How           Because Of
+===========             ===           ==========
+client-aws-1-sandbox    directly      client-aws-1-sandbox.yml
+client-aws-1-preprod    downstream    client-aws-1-sandbox
+client-aws-1-prod       downstream    client-aws-1-preprod
+EOF
+
+commit "sandbox domain";
+put_file "client-aws.yml", get_file("client-aws.yml")."  az: z1\n";
+commit "aws az";
+output_ok "genesis affected HEAD~1", <<EOF, "shared files affect every environment that inherits from them";
+Environment             How         Because Of
+===========             ===         ==========
+client-aws-1-sandbox    directly    client-aws.yml
+client-aws-1-preprod    directly    client-aws.yml
+client-aws-1-prod       directly    client-aws.yml
+EOF
+
+output_ok "genesis affected HEAD~2..HEAD", <<EOF, "revision ranges cover every commit in them";
+Environment             How         Because Of
+===========             ===         ==========
+client-aws-1-sandbox    directly    client-aws-1-sandbox.yml, client-aws.yml
+client-aws-1-preprod    directly    client-aws.yml
+client-aws-1-prod       directly    client-aws.yml
+EOF
+
+output_ok "genesis affected --columns env -f csv HEAD~1..HEAD", <<EOF, "affected environments can be listed for scripts";
+env
+client-aws-1-sandbox
+client-aws-1-preprod
+client-aws-1-prod
+EOF
+
+put_file "client.yml", get_file("client.yml")."  owner: ops\n";
+output_ok "genesis affected", <<EOF, "environments outside the pipeline are affected too";
+Environment             How         Because Of
+===========             ===         ==========
+client-aws-1-sandbox    directly    client.yml
+client-aws-1-preprod    directly    client.yml
+client-aws-1-prod       directly    client.yml
+client-gcp-1-sandbox    directly    client.yml
+EOF
+commit "owner";
+
+put_file "dev/kit.yml", get_file("dev/kit.yml")."version: 0.0.1\n";
+qx(mkdir -p .genesis/kits && touch .genesis/kits/shield-6.3.0.tar.gz .genesis/kits/shield-6.2.0.tar.gz);
+output_ok "genesis affected", <<EOF, "kit changes affect the environments that use them";
+Environment             How         Because Of
+===========             ===         ==========
+client-aws-1-sandbox    directly    dev/kit.yml
+client-aws-1-preprod    directly    dev/kit.yml
+client-aws-1-prod       directly    dev/kit.yml
+client-gcp-1-sandbox    directly    .genesis/kits/shield-6.3.0.tar.gz
+EOF
+commit "kits";
+
+put_file "client-gcp-1-sandbox.yml", get_file("client-gcp-1-sandbox.yml") =~ s/6\.3\.0/6.3.0-rc.1/r;
+commit "release candidate";
+qx(touch .genesis/kits/shield-6.3.0-rc.1.tar.gz .genesis/kits/shield-agent-6.3.0-rc.1.tar.gz);
+output_ok "genesis affected", <<EOF, "kit versions can have dashes in them";
+Environment             How         Because Of
+===========             ===         ==========
+client-gcp-1-sandbox    directly    .genesis/kits/shield-6.3.0-rc.1.tar.gz
+EOF
+commit "release candidate kit";
+
+put_file "old client.yml", get_file("client.yml");
+output_ok "genesis affected", <<EOF, "new files can have spaces in their names";
+Environment    How    Because Of
+===========    ===    ==========
+EOF
+commit "old client";
+output_ok "genesis affected HEAD~1", <<EOF, "changed files can have spaces in their names";
+Environment    How    Because Of
+===========    ===    ==========
+EOF
+
+qx(mkdir -p .genesis/cached/client-aws-1-sandbox);
+put_file ".genesis/cached/client-aws-1-sandbox/client-aws.yml", get_file("client-aws.yml");
+put_file ".genesis/cached/client-aws-1-sandbox/history", "{}\n";
+output_ok "genesis affected", <<EOF, "propagated files trigger the environments that watch them";
+Environment             How           Because Of
+===========             ===           ==========
+client-aws-1-preprod    pipeline      .genesis/cached/client-aws-1-sandbox/client-aws.yml
+client-aws-1-prod       downstream    client-aws-1-preprod
+EOF
+commit "propagate";
+
+put_file "ci.yml", get_file("ci.yml")."  tagged: yes\n";
+output_ok "genesis affected -f json", <<EOF, "pipeline configuration changes affect every environment in the pipeline";
+[
+  {
+    "because": [
+      "ci.yml"
+    ],
+    "env": "client-aws-1-sandbox",
+    "how": "pipeline"
+  },
+  {
+    "because": [
+      "ci.yml"
+    ],
+    "env": "client-aws-1-preprod",
+    "how": "pipeline"
+  },
+  {
+    "because": [
+      "ci.yml"
+    ],
+    "env": "client-aws-1-prod",
+    "how": "pipeline"
+  }
+]
+EOF
+
+qx(git checkout -q ci.yml && git mv ci.yml pipeline.yml);
+commit "rename pipeline";
+put_file "client-aws-1-sandbox.yml", get_file("client-aws-1-sandbox.yml")."  stemcell: ubuntu-bionic\n";
+output_ok "genesis affected", <<EOF, "without a pipeline, nothing is downstream";
+Environment             How         Because Of
+===========             ===         ==========
+client-aws-1-sandbox    directly    client-aws-1-sandbox.yml
+EOF
+
+output_ok "genesis affected --config pipeline.yml", <<EOF, "pipeline configuration can live elsewhere";
+Environment             How           Because Of
+===========             ===           ==========
+client-aws-1-sandbox    directly      client-aws-1-sandbox.yml
+client-aws-1-preprod    downstream    client-aws-1-sandbox
+client-aws-1-prod       downstream    client-aws-1-preprod
+EOF
+
+run_fails "genesis affected --config nope.yml", 1;
+run_fails "genesis affected HEAD~1 HEAD", 3;
+run_fails "genesis affected no-such-rev", 1;
+
+chdir $ENV{PWD};
+done_testing;
@@ -0,0 +1,100 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+ok -d "t/repos/ci-test", "ci-test repo exists" or die;
+my $genesis = qx(which genesis); chomp $genesis;
+
+# set up like a Concourse task: the deployments repo (with genesis in it)
+# is checked out as code/, from its upstream, and we work in out/git
+qx(cp -R t/repos/ci-test $tmp/src);
+qx(cd $tmp/src && git init -q && git symbolic-ref HEAD refs/heads/master && git add . &&
+   git -c user.name=test -c user.email=test\@example.com commit -q -m 'initial commit');
+qx(git clone -q --bare $tmp/src $tmp/something-deployments.git);
+qx(git clone -q $tmp/something-deployments.git $tmp/build/code);
+qx(cp $genesis $tmp/build/code/bin/genesis);
+qx(mkdir -p $tmp/build/out);
+chdir "$tmp/build" or die;
+
+$ENV{HOME}          = $tmp; # no git identity, like a fresh container
+$ENV{PATH}          = "$tmp/build/code/bin:$ENV{PATH}";
+$ENV{BOSH_LOG}      = "$tmp/bosh.log";
+$ENV{BOSH_SEEN}     = "$tmp/bosh-config.yml";
+$ENV{CURRENT_ENV}   = "client-aws-1-sandbox";
+$ENV{WORKING_DIR}   = "out/git";
+$ENV{GIT_BRANCH}    = "master";
+$ENV{BOSH_TARGET}   = "default";
+$ENV{BOSH_CONFIG}   = <<EOF;
+auth:
+  https://sandbox.example.com:25555:
+    username: sb-admin
+    password: PaeM2Eip
+alias:
+  target:
+    default: https://sandbox.example.com:25555
+EOF
+
+runs_ok "code/bin/genesis ci pipeline stage1", "stage1 deploys the current environment";
+my $log = get_file("$tmp/bosh.log");
+like $log, qr/^bosh -n -e default -d client-aws-1-sandbox-something deploy \S+$/m,
+	"stage1 deploys to BOSH_TARGET, naming the deployment after the upstream repo";
+is get_file("$tmp/bosh-config.yml"), $ENV{BOSH_CONFIG}, "stage1 hands BOSH_CONFIG to the BOSH CLI";
+
+ok -d "out/git/.git", "stage1 clones the deployments repo into WORKING_DIR";
+is qx(git -C out/git log -1 --format=%s), "deployed client-aws-1-sandbox\n",
+	"stage1 commits the deployment in WORKING_DIR";
+is qx(git -C out/git status --porcelain), "", "stage1 leaves nothing uncommitted";
+is qx(git -C out/git remote get-url origin), "$tmp/something-deployments.git\n",
+	"WORKING_DIR looks like it came from the deployments repo upstream";
+
+my $cached = "out/git/.genesis/cached/client-aws-1-sandbox";
+is get_file("$cached/client.yml"), get_file("code/client.yml"), "stage1 propagates client.yml";
+is get_file("$cached/client-aws.yml"), get_file("code/client-aws.yml"), "stage1 propagates client-aws.yml";
+ok ! -f "$cached/client-aws-1-sandbox.yml", "stage1 doesn't propagate the environment's own file";
+like get_file("$cached/history"), qr/"outcome":"succeeded"/, "stage1 records the deployment in the ledger";
+ok -f "$cached/manifest.yml", "stage1 keeps the deployed manifest";
+
+runs_ok "code/bin/genesis ci pipeline stage2", "stage2 can be run again";
+is qx(git -C out/git rev-list --count HEAD), "2\n", "stage2 doesn't commit when there's nothing new";
+
+$ENV{ERRAND_NAME} = "smoke-tests";
+runs_ok "cd out/git && genesis ci pipeline run-smoke-test", "smoke tests run from WORKING_DIR";
+like get_file("$tmp/bosh.log"), qr/^bosh -n -e default -d client-aws-1-sandbox-something run-errand smoke-tests$/m,
+	"run-smoke-test runs ERRAND_NAME against the deployment";
+
+qx(rm -rf out/git);
+$ENV{BOSH_DEPLOY_EXIT} = 1;
+run_fails "code/bin/genesis ci pipeline stage1", 1;
+is qx(git -C out/git rev-list --count HEAD), "1\n", "failed deployments aren't committed";
+$ENV{BOSH_DEPLOY_EXIT} = 0;
+
+# deployment windows, an hour or so either side of now (UTC)
+my $now = (gmtime)[2] * 60 + (gmtime)[1];
+sub hhmm { my $m = ($_[0] + 24 * 60) % (24 * 60); sprintf "%02d:%02d", int($m / 60), $m % 60 }
+
+qx(rm -rf out/git);
+$ENV{DEPLOY_WINDOW} = "daily ".hhmm($now + 60)."-".hhmm($now + 120);
+my $out = qx(code/bin/genesis ci pipeline stage1 2>&1);
+is $? >> 8, 1, "stage1 won't deploy outside of DEPLOY_WINDOW";
+like $out, qr/not deploying client-aws-1-sandbox outside of its deployment window \(daily \d\d:\d\d-\d\d:\d\d\)/,
+	"stage1 says why it won't deploy";
+ok ! -d "out/git", "stage1 checks the window before doing anything else";
+
+$ENV{DEPLOY_WINDOW} = "daily ".hhmm($now - 60)."-".hhmm($now + 60);
+runs_ok "code/bin/genesis ci pipeline stage1", "stage1 deploys inside of DEPLOY_WINDOW";
+
+$ENV{DEPLOY_WINDOW} = "someday 02:00-05:00";
+run_fails "code/bin/genesis ci pipeline stage1", 1;
+delete $ENV{DEPLOY_WINDOW};
+
+delete $ENV{CURRENT_ENV};
+$out = qx(code/bin/genesis ci pipeline stage1 2>&1);
+isnt $? >> 8, 0, "stage1 fails without a CURRENT_ENV";
+like $out, qr/CURRENT_ENV is not set/, "stage1 explains what is missing";
+
+chdir $ENV{PWD};
+done_testing;
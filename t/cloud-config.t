@@ -4,6 +4,7 @@ use warnings;
 
 use lib 't';
 use helper;
+use Cwd qw(getcwd);
 
 ok -d "t/repos/cloud-config-test", "cloud-config-test repo exists" or die;
 chdir "t/repos/cloud-config-test" or die;
@@ -29,5 +30,14 @@ releases:
   version: 1.2.3-rc.1
 EOF
 
+# the cloud-config can be fetched from the director (and cached)
+$ENV{PATH} = getcwd."/../deploy-test/bin:$ENV{PATH}";
+$ENV{BOSH_LOG} = workdir."/bosh.log";
+qx(rm -rf .genesis/cached);
+runs_ok "genesis manifest test-env", "genesis manifest fetches the cloud-config from the director";
+like get_file($ENV{BOSH_LOG}), qr/^bosh -n -e test-env cloud-config$/m,
+	"genesis manifest asks the BOSH director for its cloud-config";
+ok -f ".genesis/cached/test-env/cloud.yml", "the cloud-config is cached in .genesis/cached/ENV";
+qx(rm -rf .genesis/cached);
 
 done_testing;
@@ -0,0 +1,70 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+ok -d "t/repos/diff-test", "diff-test repo exists" or die;
+chdir "t/repos/diff-test" or die;
+
+my $out = qx(genesis compare us-east-1-sandbox us-east-1-prod 2>&1);
+is $? >> 8, 1, "genesis compare exits 1 when environments differ";
+is $out, <<EOF, "genesis compare shows all differences between two environments";
+--- us-east-1-sandbox
++++ us-east-1-prod
+
+jobs.thing.instances
+  - 2
+  + 3
+
+jobs.thing.properties.domain
+  - sb.us-east-1.example.com
+  + prod.us-east-1.example.com
+
+jobs.thing.properties.password (removed)
+  - REDACTED
+
+jobs.other (removed)
+  - instances: 1
+  - name: other
+
+name
+  - us-east-1-sandbox-diff-test
+  + us-east-1-prod-diff-test
+EOF
+
+$out = qx(genesis compare --ignore name -i 'jobs.*.properties' us-east-1-sandbox us-east-1-prod 2>&1);
+is $? >> 8, 1, "genesis compare still exits 1 when there are unexpected differences";
+is $out, <<EOF, "genesis compare skips over differences that are expected";
+--- us-east-1-sandbox
++++ us-east-1-prod
+
+jobs.thing.instances
+  - 2
+  + 3
+
+jobs.other (removed)
+  - instances: 1
+  - name: other
+EOF
+
+$out = qx(genesis compare --params -i params.env,params.bosh us-east-1-sandbox us-east-1-prod 2>&1);
+is $out, <<EOF, "genesis compare --params only compares params";
+--- us-east-1-sandbox
++++ us-east-1-prod
+
+params.domain
+  - sb.us-east-1.example.com
+  + prod.us-east-1.example.com
+
+params.instances
+  - 2
+  + 3
+EOF
+
+output_ok "genesis compare -i jobs -i name us-east-1-sandbox us-east-1-prod", <<EOF, "genesis compare exits 0 without differences";
+No differences.
+EOF
+
+done_testing;
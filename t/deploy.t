@@ -0,0 +1,83 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+use Cwd qw(getcwd);
+
+my $tmp = workdir;
+ok -d "t/repos/deploy-test", "deploy-test repo exists" or die;
+chdir "t/repos/deploy-test" or die;
+qx(rm -rf .genesis/cached);
+
+$ENV{PATH}          = getcwd."/bin:$ENV{PATH}";
+$ENV{BOSH_LOG}      = "$tmp/bosh.log";
+$ENV{BOSH_DEPLOYED} = "$tmp/deployed.yml";
+$ENV{BOSH_RUNTIME}  = "$tmp/runtime.yml";
+
+runs_ok "genesis deploy --yes --recreate us-east-1-sandbox";
+my $log = get_file("$tmp/bosh.log");
+like $log, qr/^bosh -n -e sandbox-bosh cloud-config$/m,
+	"genesis deploy fetches the cloud-config from the environment's director";
+like $log, qr/^bosh -n -e sandbox-bosh -d us-east-1-sandbox-deploy-test deploy \S+ --recreate$/m,
+	"genesis deploy passes --recreate through to `bosh deploy`";
+
+is get_file("$tmp/deployed.yml"), <<EOF, "genesis deploy hands the merged manifest to BOSH";
+jobs:
+- instances: 1
+  name: thing
+  networks:
+  - name: default
+    static_ips:
+    - 10.244.123.34
+  properties:
+    domain: sb.us-east-1.example.com
+  vm_type: small
+name: us-east-1-sandbox-deploy-test
+
+EOF
+
+like $log, qr/^bosh -n -e sandbox-bosh update-runtime-config --name us-east-1-sandbox-deploy-test \S+$/m,
+	"genesis deploy uploads the kit's runtime-config";
+is get_file("$tmp/runtime.yml"), <<EOF, "the runtime-config is merged with the environment's params";
+addons:
+- jobs:
+  - name: node-exporter
+    release: monitoring
+  name: monitoring
+  properties:
+    domain: sb.us-east-1.example.com
+releases:
+- name: monitoring
+  version: 1.0.0
+
+EOF
+
+ok -f ".genesis/cached/us-east-1-sandbox/cloud.yml", "genesis deploy caches the director's cloud-config";
+ok -f ".genesis/cached/us-east-1-sandbox/history", "genesis deploy records the deployment in the ledger";
+ok -f ".genesis/cached/us-east-1-sandbox/manifest.yml", "genesis deploy caches the deployed manifest";
+like get_file(".genesis/cached/us-east-1-sandbox/history"), qr/"outcome":"succeeded"/,
+	"successful deployment recorded as such";
+
+$ENV{BOSH_DEPLOY_EXIT} = 1;
+run_fails "genesis deploy --yes us-east-1-sandbox", 1;
+like get_file(".genesis/cached/us-east-1-sandbox/history"), qr/"outcome":"failed"/,
+	"failed deployment recorded as such";
+
+qx(rm -f $tmp/bosh.log);
+$ENV{BOSH_DEPLOY_EXIT} = 0;
+my $out = qx(genesis deploy --yes -c bad-cloud.yml us-east-1-sandbox 2>&1);
+isnt $? >> 8, 0, "genesis deploy fails if the manifest doesn't fit the cloud-config";
+like $out, qr/the following are not defined in the cloud-config:\n  - vm_type 'small' \(used by thing\)/,
+	"genesis deploy reports what is missing from the cloud-config";
+ok ! -f "$tmp/bosh.log", "genesis deploy doesn't call `bosh deploy` for bad cloud-configs";
+
+runs_ok "genesis deploy --yes --dry-run -c cloud.yml us-east-1-sandbox";
+$log = get_file("$tmp/bosh.log");
+unlike $log, qr/ cloud-config/, "genesis deploy -c doesn't fetch the cloud-config";
+unlike $log, qr/update-runtime-config/, "genesis deploy --dry-run doesn't upload the runtime-config";
+like $log, qr/deploy \S+ --dry-run$/m, "genesis deploy passes --dry-run through to `bosh deploy`";
+
+qx(rm -rf .genesis/cached);
+done_testing;
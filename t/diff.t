@@ -0,0 +1,119 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+use Cwd qw(getcwd);
+
+my $tmp = workdir;
+ok -d "t/repos/diff-test", "diff-test repo exists" or die;
+chdir "t/repos/diff-test" or die;
+
+$ENV{PATH} = getcwd."/bin:$ENV{PATH}";
+
+my $out = qx(genesis diff --cached us-east-1-sandbox 2>&1);
+is $? >> 8, 1, "genesis diff exits 1 when there are changes";
+is $out, <<EOF, "genesis diff shows changes against the cached manifest, without credentials";
+jobs.thing.instances
+  - 1
+  + 2
+
+jobs.retired (removed)
+  - instances: 1
+  - name: retired
+
+jobs.other (added)
+  + instances: 1
+  + name: other
+EOF
+
+$ENV{BOSH_MANIFEST_EXIT} = 1;
+$out = qx(genesis diff us-east-1-sandbox 2>&1);
+is $? >> 8, 1, "genesis diff falls back to the cached manifest";
+like $out, qr/^warning: `bosh manifest` failed: Deployment not found; falling back to the cached copy$/m,
+	"genesis diff warns when it cannot get the manifest from the director";
+delete $ENV{BOSH_MANIFEST_EXIT};
+
+output_ok "genesis diff us-east-1-prod", <<EOF, "genesis diff asks the director for its manifest";
+No changes.
+EOF
+
+run_fails "genesis diff --cached us-east-1-prod", 2;
+$out = qx(genesis diff --cached us-east-1-prod 2>&1);
+like $out, qr/us-east-1-prod has not been deployed/,
+	"genesis diff --cached fails if the environment was never deployed";
+
+# the director's manifest has real credentials in it, so its values are
+# only shown where the cached (redacted) manifest has them in the clear
+qx(cp us-east-1-prod.yml $tmp/us-east-1-prod.yml);
+put_file "us-east-1-prod.yml", <<EOF;
+---
+params:
+  env:       us-east-1-prod
+  bosh:      prod-bosh
+  instances: 4
+  domain:    prod.us-east-1.example.com
+
+jobs:
+  - name: thing
+    properties:
+      token: now-a-literal
+EOF
+put_file "$tmp/live.yml", <<EOF;
+---
+name: us-east-1-prod-diff-test
+jobs:
+  - name: thing
+    instances: 3
+    properties:
+      domain: prod.us-east-1.example.com
+      token: was-a-secret
+      renamed: also-a-secret
+EOF
+$ENV{BOSH_MANIFEST} = "$tmp/live.yml";
+
+$out = qx(genesis diff us-east-1-prod 2>&1);
+is $out, <<EOF, "without a cached manifest, nothing the director has is shown";
+jobs.thing.instances
+  - REDACTED
+  + 4
+
+jobs.thing.properties.renamed (removed)
+  - REDACTED
+
+jobs.thing.properties.token
+  - REDACTED
+  + now-a-literal
+EOF
+
+qx(mkdir -p .genesis/cached/us-east-1-prod);
+put_file ".genesis/cached/us-east-1-prod/manifest.yml", <<EOF;
+jobs:
+- instances: 3
+  name: thing
+  properties:
+    domain: prod.us-east-1.example.com
+    renamed: REDACTED
+    token: REDACTED
+name: us-east-1-prod-diff-test
+EOF
+$out = qx(genesis diff us-east-1-prod 2>&1);
+is $out, <<EOF, "credentials that are no longer credentials (or are gone) stay redacted";
+jobs.thing.instances
+  - 3
+  + 4
+
+jobs.thing.properties.renamed (removed)
+  - REDACTED
+
+jobs.thing.properties.token
+  - REDACTED
+  + now-a-literal
+EOF
+unlike $out, qr/was-a-secret|also-a-secret/, "old credentials never leak";
+
+qx(rm -rf .genesis/cached/us-east-1-prod; mv $tmp/us-east-1-prod.yml us-east-1-prod.yml);
+delete $ENV{BOSH_MANIFEST};
+
+done_testing;
@@ -0,0 +1,33 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+$ENV{TZ} = "UTC";
+$ENV{GENESIS_TIME_FORMAT} = "%Y-%m-%d %H:%M:%S";
+
+my $tmp = workdir;
+ok -d "t/repos/history-test", "history-test repo exists" or die;
+chdir "t/repos/history-test" or die;
+
+output_ok "genesis history us-east-1-prod", <<EOF, "history is shown newest first";
+Deployed               Operator    Kit/Version       Outcome      Duration    Manifest      Commit
+========               ========    ===========       =======      ========    ========      ======
+2017-01-15 14:22:18    dennis      some-kit/2.0.0    failed       45s         89e6c98d92    0a1b2c3d4e
+2017-01-04 16:52:13    jhunt       some-kit/1.0.0    succeeded    5m12s       3f786850e3    9d0f5ad6a4
+EOF
+
+output_ok "genesis history --limit 1 --format csv us-east-1-prod", <<EOF, "history can be limited, and formatted as CSV";
+time,operator,kit,outcome,duration,manifest,commit
+2017-01-15T14:22:18Z,dennis,some-kit/2.0.0,failed,45,89e6c98d92887913cadf06b2adb97f26cde4849b,0a1b2c3d4e5f60718293a4b5c6d7e8f901234567
+EOF
+
+output_ok "genesis summary", <<EOF, "summary reports the last successful deployment from the ledger";
+Environment       Kit/Version       Last Deployed
+===========       ===========       =============
+us-east-1-prod    some-kit/2.0.0    2017-01-04 16:52:13
+EOF
+
+done_testing;
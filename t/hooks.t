@@ -0,0 +1,125 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+ok -d "t/repos/hooks-test", "hooks-test repo exists" or die;
+
+# the deployments repo type (and so the default vault prefix)
+# comes from the name of the directory
+qx(cp -R t/repos/hooks-test $tmp/hooks-deployments);
+chdir "$tmp/hooks-deployments" or die;
+
+# what the hooks logged (see dev/hooks/log) since last we looked
+sub logged {
+	my $log = -f "hooks.log" ? get_file("hooks.log") : '';
+	unlink "hooks.log";
+	return $log;
+}
+
+output_ok "genesis do with-tls.yml echo hello world", <<EOF, "addons are run with their arguments";
+hello world
+EOF
+is logged, <<EOF, "hooks are run from the root of the repo, with the GENESIS_* environment";
+addon echo hello world [GENESIS_ROOT]
+  GENESIS_ENVIRONMENT=with-tls
+  GENESIS_KIT_NAME=dev
+  GENESIS_KIT_VERSION=
+  GENESIS_REQUESTED_FEATURES=tls
+  GENESIS_ROOT=(root)
+  GENESIS_VAULT_PREFIX=hooks/with/tls
+EOF
+
+output_ok "echo 'some input' | genesis do with-tls read", <<EOF, "addons can read from standard input";
+read 'some input'
+EOF
+logged;
+
+run_fails "genesis do without-tls fail 7", 7, "addons exit with the same code as their hook";
+is logged, <<EOF, "the vault prefix and features come from the environment";
+addon fail 7 [GENESIS_ROOT]
+  GENESIS_ENVIRONMENT=without-tls
+  GENESIS_KIT_NAME=dev
+  GENESIS_KIT_VERSION=
+  GENESIS_REQUESTED_FEATURES=
+  GENESIS_ROOT=(root)
+  GENESIS_VAULT_PREFIX=without/tls/hooks
+EOF
+
+run_fails "genesis do without-tls", 3, "addons need a name";
+run_fails "genesis do no-such-env echo hi", 1;
+
+output_ok "genesis manifest -c cloud.yml with-tls", <<EOF, "the blueprint hook picks the files to merge";
+properties:
+  from: blueprint
+  tls: true
+EOF
+is logged, <<EOF, "the check hook runs before the blueprint hook";
+check [GENESIS_ROOT]
+  GENESIS_ENVIRONMENT=with-tls
+  GENESIS_KIT_NAME=dev
+  GENESIS_KIT_VERSION=
+  GENESIS_REQUESTED_FEATURES=tls
+  GENESIS_ROOT=(root)
+  GENESIS_VAULT_PREFIX=hooks/with/tls
+blueprint [GENESIS_ROOT]
+  GENESIS_ENVIRONMENT=with-tls
+  GENESIS_KIT_NAME=dev
+  GENESIS_KIT_VERSION=
+  GENESIS_REQUESTED_FEATURES=tls
+  GENESIS_ROOT=(root)
+  GENESIS_VAULT_PREFIX=hooks/with/tls
+EOF
+
+my $out = qx(genesis manifest -c cloud.yml check-fails 2>&1);
+is $? >> 8, 1, "a failing check hook stops the manifest from being merged";
+like $out, qr/this environment will never work/, "...and the hook gets to say why";
+like $out, qr/kit check hook failed \(exited 4\)/, "...as does genesis";
+like logged, qr/\Acheck \[GENESIS_ROOT\]\n(  .*\n)*\z/, "...and the blueprint hook is never run";
+
+output_ok "echo sb.example.com | genesis new --no-secrets brand-new", <<EOF, "genesis new runs the prereqs and info hooks";
+prereqs are met
+brand-new is ready
+brand-new.yml created
+EOF
+is get_file("brand-new.yml"), <<EOF, "the new hook writes the environment file";
+---
+params:
+  env:    brand-new
+  vault:  brand/new/hooks
+  domain: sb.example.com
+EOF
+is join(' ', logged =~ m/^(\S+) \[/mg), "prereqs new info", "genesis new runs its hooks in order";
+
+# hooks that aren't there (or aren't executable) are not run
+qx(chmod -x dev/hooks/blueprint dev/hooks/addon);
+qx(rm dev/hooks/new dev/hooks/check);
+
+output_ok "genesis manifest -c cloud.yml with-tls", <<EOF, "without a blueprint hook, base/ and the subkits are merged";
+properties:
+  from: base
+  tls: true
+EOF
+is logged, '', "non-executable hooks are not run";
+
+$out = qx(genesis do with-tls echo hi 2>&1);
+is $? >> 8, 1, "genesis do fails if the kit has no addon hook";
+like $out, qr/this kit does not provide any addons/, "...and says why";
+
+output_ok "genesis new --no-secrets another-one </dev/null", <<EOF, "without a new hook, genesis writes the environment file";
+prereqs are met
+another-one is ready
+another-one.yml created
+EOF
+is get_file("another-one.yml"), <<EOF, "the default environment file is written";
+params:
+  env:   another-one
+  vault: another/one/hooks
+
+EOF
+
+chdir $ENV{PWD};
+done_testing;
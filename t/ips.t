@@ -0,0 +1,116 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+ok -d "t/repos/ips-test", "ips-test repo exists" or die;
+chdir "t/repos/ips-test" or die;
+
+output_ok "genesis manifest -c cloud.yml us-east-1-sandbox", <<EOF, "static IPs are allocated from the cloud-config";
+jobs:
+- instances: 3
+  name: thing
+  networks:
+  - name: default
+    static_ips:
+    - 10.0.0.10
+    - 10.0.0.11
+    - 10.0.0.12
+name: us-east-1-sandbox-ips-test
+EOF
+
+output_ok "genesis ips --offline", <<EOF, "genesis ips reports on static IP allocations";
+Environment          Job      Network    Static IPs
+===========          ===      =======    ==========
+us-east-1-preprod    thing    default    10.0.0.15, 10.0.0.16
+us-east-1-sandbox    thing    default    10.0.0.10, 10.0.0.11, 10.0.0.12
+us-west-1-prod       thing    default    10.0.0.12, 10.0.0.13
+EOF
+
+output_ok "genesis ips --offline --format csv us-west-*", <<EOF, "genesis ips can be limited to some environments";
+env,job,network,ips
+us-west-1-prod,thing,default,10.0.0.12 10.0.0.13
+EOF
+
+# us-east-1-dev shares a director (and so, a network) with us-east-1-preprod
+put_file "us-east-1-dev.yml", <<EOF;
+---
+params:
+  env:       us-east-1-dev
+  instances: 1
+  static_ips:
+    - job:     thing
+      network: default
+      count:   1
+      offset:  6
+EOF
+my $out = qx(genesis manifest -c cloud.yml us-east-1-preprod 2>&1);
+is $? >> 8, 0, "static IPs asked for by offset are allocated around";
+like $out, qr/static_ips:\n    - 10\.0\.0\.17\n    - 10\.0\.0\.18\n/,
+	"other environments skip past the static IPs that are taken";
+
+# us-east-1-qa asks for the same IP as us-east-1-dev, by offset
+put_file "us-east-1-qa.yml", <<EOF;
+---
+params:
+  env:       us-east-1-qa
+  instances: 1
+  static_ips:
+    - job:     thing
+      network: default
+      count:   1
+      offset:  6
+EOF
+run_fails "genesis manifest -c cloud.yml us-east-1-dev", 1;
+$out = qx(genesis manifest -c cloud.yml us-east-1-dev 2>&1);
+like $out, qr/10\.0\.0\.16 \(network default\): us-east-1-dev\/thing, us-east-1-qa\/thing/,
+	"static IP collisions between environments are detected";
+runs_ok "genesis manifest -c cloud.yml us-east-1-sandbox", "environments not involved in a collision are unaffected";
+runs_ok "genesis manifest -c cloud.yml us-west-1-prod", "environments on other directors are unaffected";
+unlink "us-east-1-qa.yml";
+unlink "us-east-1-dev.yml";
+
+# other environments allocate from their own (cached) cloud-configs
+my $cached = get_file(".genesis/cached/us-east-1-preprod/cloud.yml");
+(my $smaller = $cached) =~ s/static: \[10\.0\.0\.10 - 10\.0\.0\.19\]/static: [10.0.0.10 - 10.0.0.11]/;
+put_file ".genesis/cached/us-east-1-preprod/cloud.yml", $smaller;
+$out = qx(genesis manifest -c cloud.yml us-east-1-sandbox 2>&1);
+like $out, qr/static_ips:\n    - 10\.0\.0\.12\n    - 10\.0\.0\.13\n    - 10\.0\.0\.14\n/,
+	"static IPs are allocated around other environments' own cloud-configs";
+put_file ".genesis/cached/us-east-1-preprod/cloud.yml", $cached;
+
+# deployed environments keep their static IPs, even when a new environment
+# (allocated for before them) would otherwise take some of them
+put_file ".genesis/cached/us-east-1-sandbox/manifest.yml", <<EOF;
+jobs:
+- instances: 3
+  name: thing
+  networks:
+  - name: default
+    static_ips:
+    - 10.0.0.10
+    - 10.0.0.11
+    - 10.0.0.12
+name: us-east-1-sandbox-ips-test
+EOF
+put_file "us-east-1-dev.yml", <<EOF;
+---
+params:
+  env:       us-east-1-dev
+  instances: 1
+  static_ips:
+    - job:     thing
+      network: default
+      count:   1
+EOF
+$out = qx(genesis manifest -c cloud.yml us-east-1-sandbox 2>&1);
+like $out, qr/static_ips:\n    - 10\.0\.0\.10\n    - 10\.0\.0\.11\n    - 10\.0\.0\.12\n/,
+	"deployed environments keep their static IPs when new environments are added";
+$out = qx(genesis manifest -c cloud.yml us-east-1-dev 2>&1);
+like $out, qr/static_ips:\n    - 10\.0\.0\.13\n/, "new environments are allocated around deployed ones";
+unlink "us-east-1-dev.yml";
+unlink ".genesis/cached/us-east-1-sandbox/manifest.yml";
+
+done_testing;
@@ -0,0 +1,112 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+ok -d "t/repos/layout-test", "layout-test repo exists" or die;
+chdir "t/repos/layout-test" or die;
+
+# the problems genesis finds with one of the layouts in ci.yml
+sub problems {
+	my ($cmd, $layout, $expect, $msg) = @_;
+	my $out = qx(genesis $cmd $layout 2>&1);
+	is $? >> 8, 1, "`genesis $cmd $layout` fails";
+	is $out, "!!! pipeline layout '$layout' has problems:\n$expect", $msg;
+}
+
+output_ok "genesis describe", <<EOF, "environments are sorted after everything upstream of them, then by layout order";
+us-east-1-sandbox
+  `--> us-east-1-preprod
+        `--> us-east-1-prod
+
+us-west-1-sandbox
+  `--> us-east-1-preprod
+        `--> us-east-1-prod
+
+Changes to us-east-1-sandbox are deployed by hand (manual trigger); once successful they propagate to us-east-1-preprod (manual trigger).
+From us-east-1-preprod, they propagate to us-east-1-prod (manual trigger).
+
+Changes to us-west-1-sandbox are deployed by hand (manual trigger); once successful they propagate to us-east-1-preprod (manual trigger).
+
+us-east-1-sandbox deploys to the BOSH director at https://east-sandbox.example.com:25555.
+us-west-1-sandbox deploys to the BOSH director at https://west-sandbox.example.com:25555.
+us-east-1-preprod deploys to the BOSH director at https://east-preprod.example.com:25555.
+us-east-1-prod deploys to the BOSH director at https://east-prod.example.com:25555.
+Credentials for all environments come from the Vault at https://127.0.0.1:8200.
+EOF
+
+problems describe => "duplicates", <<EOF, "duplicate edges are reported where they appear again";
+  - line 2, column 22: duplicate edge us-east-1-sandbox -> us-east-1-preprod (first seen at line 1, column 22)
+EOF
+
+problems describe => "cycles", <<EOF, "every cycle is reported, all together";
+  - line 1, column 61: cycle detected: us-east-1-sandbox -> us-east-1-preprod -> us-east-1-prod -> us-east-1-sandbox
+  - line 3, column 19: cycle detected: us-east-1-preprod -> us-east-1-prod -> us-east-1-preprod
+  - line 2, column 22: cycle detected: us-west-1-sandbox -> us-west-1-sandbox
+EOF
+
+problems "repipe --dry-run" => "unknown-env", <<EOF, "environments need an environment file, and a BOSH director";
+  - line 1, column 22: unknown environment 'us-east-1-nope' (there is no us-east-1-nope.yml)
+  - line 1, column 22: environment 'us-east-1-nope' has no BOSH director (in boshes:)
+EOF
+
+problems "repipe --dry-run" => "no-director", <<EOF, "environments without a BOSH director are reported";
+  - line 1, column 22: environment 'us-west-1-prod' has no BOSH director (in boshes:)
+EOF
+
+problems describe => "bad-gate", <<EOF, "[approve] is the only gate";
+  - line 1, column 22: unknown gate '[deny]' (the only gate is '[approve]')
+EOF
+
+problems describe => "gate-without-arrow", <<EOF, "gates are followed by an arrow";
+  - line 1, column 32: expected '->', but found 'us-east-1-prod'
+EOF
+
+problems describe => "unterminated-gate", <<EOF, "gates have to be closed";
+  - line 1, column 22: unterminated gate (missing ']')
+EOF
+
+problems describe => "stray-bracket", <<EOF, "gates have to be opened";
+  - line 1, column 29: unexpected ']' (gates look like '[approve]')
+EOF
+
+problems describe => "half-arrow", <<EOF, "arrows need both halves";
+  - line 1, column 19: unexpected '>' (did you mean '->'?)
+EOF
+
+problems describe => "dangling-arrow", <<EOF, "arrows need an environment after them";
+  - line 1, column 21: expected environment name, but found end of line
+EOF
+
+problems describe => "bad-window-days", <<EOF, "deployment windows need real days";
+  - line 1, column 15: bad deployment window '\@someday 02:00-05:00': 'someday' is not a day of the week
+EOF
+
+problems describe => "bad-window-times", <<EOF, "deployment windows need 24-hour times";
+  - line 1, column 15: bad deployment window '\@daily 2am-5am': '2am' is not a (24-hour) time of day
+EOF
+
+problems describe => "bad-window-zone", <<EOF, "deployment windows need real time zones";
+  - line 1, column 15: bad deployment window '\@daily 02:00-05:00 Mars/Olympus_Mons': unknown time zone 'Mars/Olympus_Mons'
+EOF
+
+problems describe => "two-windows", <<EOF, "environments only get one deployment window";
+  - line 2, column 15: environment 'us-east-1-prod' already has a deployment window (\@weekdays 02:00-05:00, at line 1, column 36)
+EOF
+
+problems describe => "empty-auto", <<EOF, "auto needs at least one pattern";
+  - line 1, column 5: expected an environment pattern after 'auto', but found end of line
+EOF
+
+problems describe => "bad-auto", <<EOF, "auto patterns have to be valid globs";
+  - line 1, column 6: bad auto pattern '*sandbox\\': syntax error in pattern
+EOF
+
+problems describe => "empty", <<EOF, "layouts need at least one environment";
+  - line 1, column 1: no environments are defined
+EOF
+
+chdir $ENV{PWD};
+done_testing;
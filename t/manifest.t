@@ -4,6 +4,7 @@ use warnings;
 
 use lib 't';
 use helper;
+use Cwd qw(getcwd);
 
 my $tmp = workdir;
 ok -d "t/repos/manifest-test", "manifest-test repo exists" or die;
@@ -41,5 +42,63 @@ releases:
 
 EOF
 
+output_ok "genesis manifest -c cloud.yml --format json us-east-1-sandbox", <<EOF, "manifests can be formatted as JSON";
+{
+  "jobs": [
+    {
+      "name": "thing",
+      "properties": {
+        "domain": "sb.us-east-1.example.com",
+        "endpoint": "https://sb.us-east-1.example.com:8443"
+      },
+      "templates": [
+        {
+          "name": "bar",
+          "release": "foo"
+        }
+      ]
+    }
+  ],
+  "releases": [
+    {
+      "name": "foo",
+      "version": "1.2.3-rc.1"
+    }
+  ]
+}
+EOF
+
+output_ok "genesis manifest -c cloud.yml --path jobs.thing.properties us-east-1-sandbox", <<EOF, "--path prints just part of the manifest";
+domain: sb.us-east-1.example.com
+endpoint: https://sb.us-east-1.example.com:8443
+EOF
+
+output_ok "genesis manifest -c cloud.yml --params-only us-west-1-sandbox", <<EOF, "--params-only prints just the params";
+domain: sandbox.us-west-1.example.com
+env: sandbox
+site: us-west-1
+EOF
+
+output_ok "genesis manifest -c cloud.yml --params-only -p domain -f json us-west-1-sandbox", <<EOF, "--path is relative to the params with --params-only";
+"sandbox.us-west-1.example.com"
+EOF
+
+run_fails "genesis manifest -c cloud.yml --path jobs.nope us-east-1-sandbox", 1;
+run_fails "genesis manifest -c cloud.yml --format toml us-east-1-sandbox", 1;
+
+my $out = qx(genesis manifest -c cloud.yml compiled-sandbox 2>&1);
+is $? >> 8, 1, "environments using compiled kits fail cleanly";
+like $out, qr/compiled kits are not supported yet/, "...and say why";
+unlike $out, qr/panic/, "...without panicking";
+
+# the dev/ kit is found relative to the deployments repo, not to where
+# genesis was run from
+my $root = getcwd;
+chdir $tmp or die;
+output_ok "genesis -C $root manifest -c $root/cloud.yml --path releases us-east-1-sandbox", <<EOF, "-C finds the dev/ kit in the deployments repo";
+- name: foo
+  version: 1.2.3-rc.1
+EOF
+chdir $root;
 
 done_testing;
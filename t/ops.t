@@ -0,0 +1,49 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+ok -d "t/repos/ops-test", "ops-test repo exists" or die;
+chdir "t/repos/ops-test" or die;
+
+output_ok "genesis manifest us-west-1-prod", <<EOF, "kit ops-files are applied after the merge";
+instance_groups:
+- instances: 1
+  jobs:
+  - name: thing
+    properties:
+      domain: us-west-1.example.com
+    release: foo
+  - name: syslog-forwarder
+    release: syslog
+  name: thing
+name: us-west-1-prod-ops-test
+releases:
+- name: syslog
+  version: latest
+EOF
+
+output_ok "genesis manifest us-east-1-sandbox", <<EOF, "environment ops-files are applied after the kit's";
+instance_groups:
+- instances: 3
+  jobs:
+  - name: thing
+    properties: {}
+    release: foo
+  - name: syslog-forwarder
+    release: syslog
+  name: thing
+name: us-east-1-sandbox-ops-test
+releases:
+- name: syslog
+  version: latest
+EOF
+
+run_fails "genesis manifest us-east-1-broken", 1;
+my $out = qx(genesis manifest us-east-1-broken 2>&1);
+like $out, qr{ops/broken\.yml, operation #1 \(replace /instance_groups/name=nope/instances\): found no list element where name=nope},
+	"ops-files that don't apply cleanly are reported";
+
+done_testing;
@@ -0,0 +1,138 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+ok -d "t/repos/params-test", "params-test repo exists" or die;
+chdir "t/repos/params-test" or die;
+qx(rm -f client-*.yml);
+
+runs_ok "printf 'NOT A DOMAIN\\nexample.com\\n\\n' | genesis new --no-secrets client-sandbox";
+is get_file("client-sandbox.yml"), <<EOF, "`genesis new` asks for (and validates) kit params";
+params:
+  env:   client-sandbox
+  vault: client/sandbox/params/test
+
+  # What domain shall we use?
+  domain: example.com
+
+  # How many web nodes do you need?
+  instances: 2
+
+EOF
+
+run_fails "genesis new --yes --no-secrets client-preprod </dev/null", 1;
+ok ! -f "client-preprod.yml", "`genesis new --yes` refuses to guess params with no default";
+
+runs_ok "genesis new --yes --no-secrets --answers answers.yml client-prod </dev/null";
+is get_file("client-prod.yml"), <<EOF, "`genesis new` takes answers from an answers file";
+params:
+  env:   client-prod
+  vault: client/prod/params/test
+
+  # What domain shall we use?
+  domain: prod.example.com
+
+  # How many web nodes do you need?
+  instances: 5
+
+EOF
+
+$ENV{GENESIS_PARAM_DOMAIN} = "dev.example.com";
+runs_ok "genesis new --non-interactive --no-secrets client-dev </dev/null";
+is get_file("client-dev.yml"), <<EOF, "`genesis new` takes answers from the environment";
+params:
+  env:   client-dev
+  vault: client/dev/params/test
+
+  # What domain shall we use?
+  domain: dev.example.com
+
+  # How many web nodes do you need?
+  instances: 2
+
+EOF
+delete $ENV{GENESIS_PARAM_DOMAIN};
+
+run_fails "genesis new --non-interactive --no-secrets other-env </dev/null >$tmp/errors 2>&1", 1;
+ok ! -f "other-env.yml", "`genesis new --non-interactive` creates nothing if params are missing";
+like get_file("$tmp/errors"), qr/required params:\n  - domain .*\n  - region /m,
+	"`genesis new --non-interactive` lists all of the missing params";
+
+qx(rm -f client-*.yml);
+
+# secret params go in the Vault, unless --no-secrets says otherwise
+qx(mkdir -p $tmp/secret-params/dev $tmp/bin);
+put_file "$tmp/secret-params/dev/kit.yml", <<EOF;
+---
+name: Secret Params Test Kit
+
+params:
+  - name:        api_key
+    description: What is the API key?
+    secret:      yes
+EOF
+put_file "$tmp/bin/safe", <<EOF;
+#!/bin/sh
+echo "safe \$*" >>$tmp/safe.log
+exit 1
+EOF
+chmod 0755, "$tmp/bin/safe";
+chdir "$tmp/secret-params" or die;
+{
+	local $ENV{PATH} = "$tmp/bin:$ENV{PATH}";
+	local $ENV{GENESIS_PARAM_API_KEY} = "sekrit";
+
+	output_ok "genesis new --non-interactive --no-secrets an-env </dev/null", <<EOF, "`genesis new --no-secrets` says where secret params should go";
+not storing api_key in the Vault (--no-secrets); put it in secret/an/env/secret/params/params/api_key:value yourself
+an-env.yml created
+EOF
+	ok ! -f "$tmp/safe.log", "`genesis new --no-secrets` never touches the Vault";
+	like get_file("an-env.yml"), qr{api_key: \(\( vault "secret/an/env/secret/params/params/api_key:value" \)\)},
+		"secret params are still referenced from the Vault";
+
+	run_fails "genesis new --non-interactive other-env </dev/null", 1;
+	ok -f "$tmp/safe.log", "without --no-secrets, secret params go in the Vault";
+	unlike get_file("$tmp/safe.log"), qr/sekrit/, "secret params are never put on safe's command line";
+	ok ! -f "other-env.yml", "nothing is created if the Vault can't take them";
+}
+
+# secret params that were already in the Vault get their old values back
+# when `genesis new` fails after overwriting them
+my $key = "secret/third/env/secret/params/params/api_key";
+qx(mkdir -p $tmp/vault/secret/third/env/secret/params/params $tmp/vault-bin dev/hooks);
+put_file "$tmp/vault/$key:value", "the old key";
+put_file "$tmp/vault-bin/safe", <<EOF;
+#!/bin/sh
+cd $tmp/vault || exit 1
+case "\$1" in
+(exists) test -e "\$2" ;;
+(get)    cat "\$2" ;;
+(set)    mkdir -p "\$(dirname "\$2")" && cp "\${3#*@}" "\$2:\${3%%@*}" ;;
+(delete) rm -f "\$3" ;;
+(*)      exit 1 ;;
+esac
+EOF
+chmod 0755, "$tmp/vault-bin/safe";
+put_file "dev/hooks/new", <<EOF;
+#!/bin/sh
+echo >&2 "the new hook has failed"
+exit 1
+EOF
+chmod 0755, "dev/hooks/new";
+{
+	local $ENV{PATH} = "$tmp/vault-bin:$ENV{PATH}";
+	local $ENV{GENESIS_PARAM_API_KEY} = "the new key";
+
+	run_fails "genesis new --non-interactive third-env </dev/null >$tmp/errors 2>&1", 1;
+	is get_file("$tmp/vault/$key:value"), "the old key", "overwritten secret params are restored on failure";
+	like get_file("$tmp/errors"), qr/^  - restored secret \Q$key:value\E$/m, "...and genesis says so";
+	unlike get_file("$tmp/errors"), qr/the (old|new) key/, "...without showing either value";
+	ok ! -f "third-env.yml", "nothing is created when the new hook fails";
+}
+chdir $ENV{PWD};
+
+done_testing;
@@ -0,0 +1,53 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+use Cwd qw(getcwd);
+
+my $tmp = workdir;
+ok -d "t/repos/policy-test", "policy-test repo exists" or die;
+chdir "t/repos/policy-test" or die;
+
+my $out = qx(genesis check -c cloud.yml us-east-1-prod 2>&1);
+is $? >> 8, 1, "genesis check exits 1 when policy rules are violated";
+is $out, <<EOF, "genesis check lists all violations, by rule";
+PROD-001  Production jobs must have more than one instance
+  - instance_groups.thing.instances: 1 is less than 2
+
+DISK-001  Every job needs an approved persistent disk type
+  - instance_groups.cache.persistent_disk_type: is missing
+  - instance_groups.thing.persistent_disk_type: 'huge' is not one of small, medium, large
+
+SEC-001  Passwords must come from the Vault
+  - instance_groups.cache.properties.admin_password: 'hunter2' does not match /^REDACTED\$/
+
+AZ-001  Jobs should be spread across availability zones (warning)
+  - instance_groups.thing.azs: is missing
+  - instance_groups.cache.azs: is missing
+EOF
+
+output_ok "genesis check -c cloud.yml us-east-1-sandbox", <<EOF, "warnings don't fail genesis check";
+AZ-001  Jobs should be spread across availability zones (warning)
+  - instance_groups.thing.azs: is missing
+EOF
+
+$ENV{PATH}     = getcwd."/../deploy-test/bin:$ENV{PATH}";
+$ENV{BOSH_LOG} = "$tmp/bosh.log";
+$out = qx(genesis deploy --yes -c cloud.yml us-east-1-prod 2>&1);
+isnt $? >> 8, 0, "genesis deploy refuses to deploy environments that violate policy";
+like $out, qr/us-east-1-prod violates the following policy rules:\n  - \[PROD-001\] instance_groups\.thing\.instances: 1 is less than 2/,
+	"genesis deploy lists policy violations";
+like $out, qr/^warning: \[AZ-001\] instance_groups\.thing\.azs: is missing$/m,
+	"genesis deploy prints policy warnings";
+unlike $out, qr/  - \[AZ-001\]/, "genesis deploy doesn't list warnings as violations";
+ok ! -f "$tmp/bosh.log", "genesis deploy doesn't call `bosh deploy` when policy is violated";
+
+$out = qx(genesis deploy --yes -c cloud.yml us-east-1-sandbox 2>&1);
+is $? >> 8, 0, "genesis deploy deploys environments that only have policy warnings" or diag $out;
+like get_file("$tmp/bosh.log"), qr/^bosh -n -e \S+ -d us-east-1-sandbox-policy-test deploy \S+$/m,
+	"genesis deploy calls `bosh deploy` when policy is met";
+
+qx(rm -rf .genesis/cached);
+done_testing;
@@ -0,0 +1,33 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+vault_ok;
+
+ok -d "t/repos/rollback-test", "rollback-test repo exists" or die;
+chdir "t/repos/rollback-test";
+qx(rm -f *.yml);
+
+run_fails "genesis new --vault unit-tests x-y-z >$tmp/errors 2>&1", 1;
+ok ! -f "x-y-z.yml", "`genesis new` leaves no environment file behind when it fails";
+ok ! -f ".x-y-z.yml.new", "`genesis new` leaves no staged environment file behind when it fails";
+
+diag "connecting to the local vault (this may take a while)...";
+no_secret "secret/x/y/z/rollback/test/random:password", "random password was rolled back";
+no_secret "secret/x/y/z/rollback/test/ssh:private", "ssh key was rolled back";
+
+my $errors = get_file("$tmp/errors");
+like $errors, qr/the secrets hook has failed/, "`genesis new` fails because of the secrets hook";
+like $errors, qr/^the following changes were rolled back:$/m, "`genesis new` reports what it rolled back";
+unlike $errors, qr/USAGE/, "`genesis new` got as far as generating secrets";
+like $errors, qr{deleted secret secret/x/y/z/rollback/test/random:password},
+	"`genesis new` reports rolling back the random password";
+like $errors, qr{deleted secret secret/x/y/z/rollback/test/ssh},
+	"`genesis new` reports rolling back the ssh key";
+
+teardown_vault;
+done_testing;
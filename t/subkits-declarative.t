@@ -0,0 +1,66 @@
+#!perl
+use strict;
+use warnings;
+
+use lib 't';
+use helper;
+
+my $tmp = workdir;
+ok -d "t/repos/subkit-decl-test", "subkit-decl-test repo exists" or die;
+chdir "t/repos/subkit-decl-test" or die;
+
+runs_ok "genesis manifest -c cloud.yml use-s3 >$tmp/manifest.yml";
+is get_file("$tmp/manifest.yml"), <<EOF, "manifest generated with s3 subkit";
+properties:
+  blobstore:
+    config:
+      aki: yup, we got one
+      secret: haha
+    type: s3
+
+EOF
+
+runs_ok "genesis manifest -c cloud.yml use-s3-tls >$tmp/manifest.yml";
+is get_file("$tmp/manifest.yml"), <<EOF, "manifest generated with s3 and tls subkits";
+properties:
+  blobstore:
+    config:
+      aki: yup, we got one
+      secret: haha
+    tls: true
+    type: s3
+
+EOF
+
+run_fails "genesis manifest -c cloud.yml use-the-wrong-thing >$tmp/errors", 67;
+is get_file("$tmp/errors"), <<EOF, "manifest generate fails with an invalid blobstore_type param";
+'magic' does not look like a valid blobstore_type.
+
+I need to know what blobstore type you wish to use
+for this deployment.
+Valid values are:
+
+  s3      an Amazon-backed blobstore solution
+  webdav  a locally-hosted HTTP/DAV solution
+EOF
+
+run_fails "genesis manifest -c cloud.yml use-nothing >$tmp/errors", 66;
+is get_file("$tmp/errors"), <<EOF, "manifest generate fails without a valid blobstore_type param";
+I could not find params.blobstore_type in use-nothing
+(or in any of its predecessor files).
+
+I need to know what blobstore type you wish to use
+for this deployment.
+Valid values are:
+
+  s3      an Amazon-backed blobstore solution
+  webdav  a locally-hosted HTTP/DAV solution
+EOF
+
+run_fails "genesis manifest -c cloud.yml use-webdav-tls >$tmp/errors", 67;
+is get_file("$tmp/errors"), <<EOF, "manifest generate fails with conflicting subkits";
+The 'tls' subkit (activated by params.tls = true) cannot be used
+together with the 'webdav' subkit (activated by params.blobstore_type = webdav).
+EOF
+
+done_testing;
@@ -33,5 +33,20 @@ client-aws1-sandbox    some-kit/2.0.0    2017-01-15 14:22:18
 client-aws2-sandbox    some-kit/2.0.0    never
 EOF
 
+output_ok "genesis summary --columns env,constraint,director 'client-aws1-p*'", <<EOF, "summary can be filtered, with custom columns";
+Environment            Version (requested)    BOSH Director
+===========            ===================    =============
+client-aws1-preprod    2.0.0                  client-aws1-preprod
+client-aws1-prod       1.0.0                  client-aws1-prod
+EOF
+
+output_ok "genesis summary --format csv --columns env,kit,vault", <<EOF, "summary can be formatted as CSV";
+env,kit,vault
+client-aws1-preprod,some-kit/2.0.0,client/aws1/preprod/summary/test
+client-aws1-prod,some-kit/1.0.0,client/aws1/prod/summary/test
+client-aws1-sandbox,some-kit/2.0.0,client/aws1/sandbox/summary/test
+client-aws2-sandbox,some-kit/2.0.0,client/aws2/sandbox/summary/test
+EOF
+
 
 done_testing;
@@ -0,0 +1,136 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/jhunt/genesis/kit"
+)
+
+// A Vault is a `safe' target; all interaction with it goes through
+// the safe CLI, so that operators' ~/.saferc is honored.
+type Vault struct {
+	Target string
+}
+
+func (v Vault) safe(args ...string) *exec.Cmd {
+	if v.Target != "" {
+		args = append([]string{"-T", v.Target}, args...)
+	}
+	cmd := exec.Command("safe", args...)
+	cmd.Env = os.Environ()
+	return cmd
+}
+
+func (v Vault) run(args ...string) error {
+	_, err := v.output(args...)
+	return err
+}
+
+// run safe, for its standard output (which is never part of the error)
+func (v Vault) output(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := v.safe(args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("`safe %s` failed: %s", redact(args), msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// the safe command line, fit for error messages; credentials are never
+// passed as key=value, but just in case, values are not shown.
+func redact(args []string) string {
+	l := make([]string, len(args))
+	for i, arg := range args {
+		if n := strings.Index(arg, "="); n > 0 {
+			arg = arg[:n] + "=REDACTED"
+		}
+		l[i] = arg
+	}
+	return strings.Join(l, " ")
+}
+
+// Make sure the Vault is reachable (and that we are authenticated).
+func (v Vault) Ping() error {
+	return v.run("exists", "secret/")
+}
+
+func (v Vault) Exists(path string) bool {
+	return v.safe("exists", path).Run() == nil
+}
+
+// Read a single value from the Vault.
+func (v Vault) Get(path, key string) (string, error) {
+	b, err := v.output("get", path+":"+key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// Store a value in the Vault.  It is handed to safe in a file (as
+// key@file), and not on the command line, where anyone could see it.
+func (v Vault) Set(path, key, value string) error {
+	f, err := ioutil.TempFile("", "genesis-safe-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return v.run("set", path, key+"@"+f.Name())
+}
+
+func (v Vault) Delete(path string) error {
+	return v.run("delete", "-f", path)
+}
+
+func Path(prefix string, s kit.Secret) string {
+	return "secret/" + strings.Trim(prefix, "/") + "/" + s.Path
+}
+
+// the path (and key, if it has one) of a credential, i.e. secret/x/y:password
+func Ref(prefix string, s kit.Secret) string {
+	if s.Key != "" {
+		return Path(prefix, s) + ":" + s.Key
+	}
+	return Path(prefix, s)
+}
+
+// Generate a credential under the given prefix.  Existing credentials
+// are left alone, unless rotate is set and the credential isn't fixed.
+// Returns whether or not anything was (re-)generated.
+func (v Vault) Generate(prefix string, s kit.Secret, rotate bool) (bool, error) {
+	path := Path(prefix, s)
+	if v.Exists(Ref(prefix, s)) && (!rotate || s.Fixed) {
+		return false, nil
+	}
+
+	size := strconv.Itoa(s.Size)
+	switch s.Type {
+	case "random":
+		return true, v.run("gen", size, path, s.Key)
+	case "ssh":
+		return true, v.run("ssh", size, path)
+	case "rsa":
+		return true, v.run("rsa", size, path)
+	}
+	return false, fmt.Errorf("unrecognized credential type '%s' for %s", s.Type, s)
+}